@@ -0,0 +1,86 @@
+// Comando admin: operações manuais direto no banco.
+//
+//	admin dead-letter list [-limit N]
+//	admin dead-letter requeue -all | <correlationId>...
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/config"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 3 || os.Args[1] != "dead-letter" {
+		usage()
+	}
+	cfg := config.FromEnv()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := repo.Connect(ctx, cfg.DBDriver, cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+	defer db.Close(context.Background())
+
+	switch os.Args[2] {
+	case "list":
+		deadLetterList(ctx, db, os.Args[3:])
+	case "requeue":
+		deadLetterRequeue(ctx, db, os.Args[3:])
+	default:
+		usage()
+	}
+}
+
+func deadLetterList(ctx context.Context, db repo.DB, args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	limit := fs.Int("limit", 100, "máximo de itens")
+	_ = fs.Parse(args)
+
+	items, err := db.ListFailed(ctx, *limit)
+	if err != nil {
+		log.Fatalf("list: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, it := range items {
+		_ = enc.Encode(it)
+	}
+}
+
+func deadLetterRequeue(ctx context.Context, db repo.DB, args []string) {
+	fs := flag.NewFlagSet("requeue", flag.ExitOnError)
+	all := fs.Bool("all", false, "devolve todos os FAILED para PENDING")
+	_ = fs.Parse(args)
+
+	var ids []uuid.UUID
+	for _, s := range fs.Args() {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			log.Fatalf("invalid correlationId %q: %v", s, err)
+		}
+		ids = append(ids, id)
+	}
+	if *all == (len(ids) > 0) {
+		log.Fatal("requeue: use -all or pass correlationIds (not both)")
+	}
+	n, err := db.Requeue(ctx, ids)
+	if err != nil {
+		log.Fatalf("requeue: %v", err)
+	}
+	fmt.Printf("requeued %d\n", n)
+}
+
+func usage() {
+	log.Fatal("usage: admin dead-letter list [-limit N] | admin dead-letter requeue -all | <correlationId>...")
+}
@@ -11,45 +11,135 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/josinaldojr/rinha-backend-2025/internal/auditor"
 	"github.com/josinaldojr/rinha-backend-2025/internal/config"
 	"github.com/josinaldojr/rinha-backend-2025/internal/decider"
 	"github.com/josinaldojr/rinha-backend-2025/internal/dispatcher"
 	"github.com/josinaldojr/rinha-backend-2025/internal/handlers"
+	"github.com/josinaldojr/rinha-backend-2025/internal/metrics"
+	"github.com/josinaldojr/rinha-backend-2025/internal/notifier"
 	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
 	"github.com/josinaldojr/rinha-backend-2025/internal/reconciler"
+	"github.com/josinaldojr/rinha-backend-2025/internal/refunder"
 	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
 	"github.com/josinaldojr/rinha-backend-2025/internal/server"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
 )
 
 func main() {
 	cfg := config.FromEnv()
 
-	db, err := repo.Open(context.Background(), cfg.DatabaseURL)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter, cfg.InstanceID, cfg.TracingSampleRatio)
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
+
+	db, err := repo.Connect(context.Background(), cfg.DBDriver, cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("db open: %v", err)
 	}
+	// group-commit do intake: EnsureUnique concorrentes viram um INSERT multi-linha
+	db = repo.Coalesce(db, cfg.IntakeCoalesceWindow, cfg.IntakeCoalesceMax)
 	defer db.Close(context.Background())
 
-	proc := processors.NewClient(cfg.PPDefaultURL, cfg.PPFallbackURL)
-	d := decider.New()
+	specs := make([]processors.Spec, 0, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		specs = append(specs, processors.Spec{Name: processors.Provider(p.Name), BaseURL: p.URL, Priority: p.Priority, Fee: p.Fee, FeeFixed: p.FeeFixed})
+	}
+	reg, err := processors.NewRegistry(specs)
+	if err != nil {
+		log.Fatalf("providers: %v", err)
+	}
+	proc := processors.NewClient(reg)
+	proc.SetAdminToken(cfg.ProcessorAdminToken)
+	strategy, err := decider.NewStrategy(cfg.RoutingStrategy)
+	if err != nil {
+		log.Fatalf("routing: %v", err)
+	}
+	d := decider.New(reg, strategy)
+	for _, p := range reg.Names() {
+		metrics.BreakerState(string(p), int(decider.BreakerClosed))
+	}
+	d.OnBreakerChange(func(ev decider.BreakerEvent) {
+		metrics.Breaker(string(ev.Provider), int(ev.To), ev.To.String(), ev.Remote)
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Workers
-	decider.StartHealthWorker(ctx, db, proc, d)
-	dispatcher.Start(ctx, db, proc, d)
+	decider.StartHealthWorker(ctx, db, proc, d, cfg.InstanceID)
+	perProvider := make(map[processors.Provider]int, len(cfg.ProviderConcurrency))
+	for name, n := range cfg.ProviderConcurrency {
+		perProvider[processors.Provider(name)] = n
+	}
+	dispatched := dispatcher.Start(ctx, db, proc, d, dispatcher.Options{
+		Workers:     cfg.DispatchWorkers,
+		PerProvider: perProvider,
+		Retry: retry.Policy{
+			MaxAttempts: cfg.RetryMaxAttempts,
+			BaseBackoff: cfg.RetryBaseBackoff,
+			MaxBackoff:  cfg.RetryMaxBackoff,
+		},
+		Owner: cfg.InstanceID,
+		Lease: cfg.LeaseDuration,
+	})
 	reconciler.Start(ctx, db, proc)
+	refunder.Start(ctx, db, proc, retry.Policy{
+		MaxAttempts: cfg.RefundMaxAttempts,
+		BaseBackoff: cfg.RetryBaseBackoff,
+		MaxBackoff:  cfg.RetryMaxBackoff,
+	})
+	notifier.Start(ctx, db, notifier.Options{
+		Secret:       cfg.WebhookSecret,
+		Workers:      cfg.WebhookWorkers,
+		AllowPrivate: cfg.WebhookAllowPrivate,
+		Retry: retry.Policy{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			BaseBackoff: cfg.WebhookBaseBackoff,
+			MaxBackoff:  cfg.WebhookMaxBackoff,
+		},
+	})
+
+	audit := auditor.New(db, proc, auditor.Options{
+		Every:  cfg.AuditEvery,
+		Window: cfg.AuditWindow,
+		Lag:    cfg.AuditLag,
+	})
+	audit.Start(ctx)
+	metrics.StartBacklog(ctx, db, 2*time.Second)
 
 	// Handlers/Router
-	h := handlers.New(db)
+	h := handlers.New(db, reg)
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.Timeout(5 * time.Second))
+	r.Use(metrics.HTTP)
+	r.Use(tracing.HTTP)
 
 	r.Post("/payments", h.CreatePayment)
+	r.Post("/payments/batch", h.CreatePaymentBatch)
+	r.Get("/payments/{correlationId}", h.GetPayment)
+	r.Post("/payments/{correlationId}/refund", h.Refund)
 	r.Get("/payments-summary", h.Summary)
+	r.Get("/payments-summary/series", h.SummarySeries)
+
+	// /admin só existe com ADMIN_TOKEN: a porta 9999 é pública (atrás do nginx)
+	if cfg.AdminToken != "" {
+		adm := handlers.NewAdmin(db, cfg.AdminToken, audit)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(adm.Auth)
+			r.Get("/dead-letter", adm.DeadLetter)
+			r.Post("/dead-letter/requeue", adm.Requeue)
+			r.Get("/webhooks/{correlationId}", adm.WebhookDeliveries)
+			r.Get("/reconciliation", adm.Reconciliation)
+		})
+	} else {
+		log.Printf("ADMIN_TOKEN not set: /admin endpoints disabled")
+	}
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 	r.Get("/ready", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
 
@@ -62,6 +152,20 @@ func main() {
 		}
 	}()
 
+	// métricas internas fora do router público (sem passar pelo nginx)
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		mr := chi.NewRouter()
+		mr.Handle("/metrics", metrics.Handler())
+		metricsSrv = server.New(mr, cfg.MetricsAddr)
+		go func() {
+			log.Printf("metrics listening on %s", cfg.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("metrics server: %v", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -70,4 +174,14 @@ func main() {
 	ctx2, c2 := context.WithTimeout(context.Background(), 5*time.Second)
 	defer c2()
 	_ = srv.Shutdown(ctx2)
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(ctx2)
+	}
+	// espera os itens em andamento no dispatcher serem finalizados
+	select {
+	case <-dispatched:
+	case <-ctx2.Done():
+	}
+	// descarrega os spans pendentes do exporter
+	_ = shutdownTracing(ctx2)
 }
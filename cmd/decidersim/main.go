@@ -0,0 +1,101 @@
+// Comando decidersim: roda o Decider contra providers roteirizados (latência,
+// janelas de queda, health check) em tempo virtual e reporta participação, fees,
+// falhas e percentis de latência por provider.
+//
+//	decidersim [-scenario cenario.json] [-strategy ewma] [-margin 150ms] [-epsilon 0.01]
+//	           [-cb-fail-rate 0.25] [-cb-open-for 2s] [-cb-window 100] [-seed 1]
+//
+// Sem -scenario usa um cenário embutido (default cai por 10s e fica lento depois).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/decider"
+)
+
+func main() {
+	log.SetFlags(0)
+	scenarioPath := flag.String("scenario", "", "cenário em JSON (vazio = embutido)")
+	strategyName := flag.String("strategy", "ewma", "estratégia (ewma, cost, wrr, thompson, revenue)")
+	margin := flag.Duration("margin", 150*time.Millisecond, "ewma: margem de latência a favor do preferido")
+	epsilon := flag.Float64("epsilon", 0.01, "ewma: taxa de exploração")
+	var bcfg decider.BreakerConfig
+	flag.Float64Var(&bcfg.FailRate, "cb-fail-rate", 0.25, "taxa de falha que abre o breaker")
+	flag.DurationVar(&bcfg.OpenFor, "cb-open-for", 2*time.Second, "tempo aberto antes do half-open")
+	flag.IntVar(&bcfg.Window, "cb-window", 100, "janela deslizante do breaker (chamadas)")
+	flag.IntVar(&bcfg.MinSamples, "cb-min-samples", 40, "mínimo de amostras para avaliar")
+	flag.IntVar(&bcfg.HalfOpenMax, "cb-half-open", 5, "chamadas de teste no half-open")
+	seed := flag.Uint64("seed", 1, "semente dos sorteios do cenário e da estratégia")
+	verbose := flag.Bool("v", false, "mostra as transições de breaker")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard) // o Decider loga cada transição
+	}
+	sc, err := loadScenario(*scenarioPath)
+	if err != nil {
+		fatal("scenario: %v", err)
+	}
+	if sc.RPS <= 0 || sc.Duration <= 0 {
+		fatal("scenario: rps and duration must be > 0")
+	}
+
+	// sorteios da estratégia (epsilon, Thompson) num stream próprio da mesma semente:
+	// mesma -seed, mesma rodada
+	srng := rand.New(rand.NewPCG(*seed^0x5851f42d4c957f2d, *seed))
+	var strategy decider.Strategy
+	if *strategyName == "ewma" {
+		strategy = decider.NewEWMAStrategyWithRand(*margin, *epsilon, srng)
+	} else if strategy, err = decider.NewStrategyWithRand(*strategyName, srng); err != nil {
+		fatal("%v", err)
+	}
+
+	res, err := simulate(sc, strategy, bcfg, *seed)
+	if err != nil {
+		fatal("simulate: %v", err)
+	}
+	report(os.Stdout, sc, res)
+}
+
+func report(out io.Writer, sc scenario, res result) {
+	fmt.Fprintf(out, "%s virtual, %.0f rps: %d payments, %d processed, %d lost\n\n",
+		time.Duration(sc.Duration), sc.RPS, res.Payments, res.Processed, res.Lost)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "provider\tshare\tcalls\tok\tfailed\tfees\tp50 ms\tp90 ms\tp99 ms\topened\t")
+	var fees float64
+	for _, p := range res.Order {
+		st := res.Providers[p]
+		share := 0.0
+		if res.Processed > 0 {
+			share = float64(st.Succeeded) / float64(res.Processed) * 100
+		}
+		fees += st.Fees
+		fmt.Fprintf(w, "%s\t%.1f%%\t%d\t%d\t%d\t%.2f\t%.1f\t%.1f\t%.1f\t%d\t\n",
+			p, share, st.Calls, st.Succeeded, st.Failed, st.Fees,
+			percentile(st.latencies, 0.50), percentile(st.latencies, 0.90), percentile(st.latencies, 0.99),
+			st.Breaker[decider.BreakerOpen])
+	}
+	_ = w.Flush()
+	fmt.Fprintf(out, "\ntotal fees: %.2f (%.2f%% of processed amount)\n", fees, pctOf(fees, float64(res.Processed)*sc.Amount))
+}
+
+func pctOf(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total * 100
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
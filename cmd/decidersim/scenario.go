@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// duration aceita "150ms", "10s" etc. no JSON do cenário
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// behavior: como um provider responde; nas fases, campos nil herdam da base.
+type behavior struct {
+	LatencyMs *float64 `json:"latencyMs"` // média
+	JitterMs  *float64 `json:"jitterMs"`  // desvio padrão (normal truncada em 1ms)
+	ErrorRate *float64 `json:"errorRate"`
+	Failing   *bool    `json:"failing"` // tudo falha e o health reporta failing
+}
+
+type phase struct {
+	From duration `json:"from"`
+	To   duration `json:"to"`
+	behavior
+}
+
+type providerScript struct {
+	Name     string  `json:"name"`
+	Priority int     `json:"priority"`
+	Fee      float64 `json:"fee"`
+	FeeFixed float64 `json:"feeFixed"`
+	behavior
+	Phases []phase `json:"phases"`
+}
+
+type scenario struct {
+	Duration    duration         `json:"duration"`
+	RPS         float64          `json:"rps"`
+	Amount      float64          `json:"amount"`
+	TimeoutMs   float64          `json:"timeoutMs"`   // timeout do Pay; acima disso conta como falha
+	HealthEvery duration         `json:"healthEvery"` // período do health check
+	Retries     int              `json:"retries"`     // novas tentativas por pagamento
+	RetryDelay  duration         `json:"retryDelay"`
+	Providers   []providerScript `json:"providers"`
+}
+
+// defaultScenario: default barato cai por 10s e fica lento depois; fallback é estável e caro.
+func defaultScenario() scenario {
+	f := func(v float64) *float64 { return &v }
+	yes := true
+	return scenario{
+		Duration:    duration(60 * time.Second),
+		RPS:         500,
+		Amount:      19.90,
+		TimeoutMs:   550,
+		HealthEvery: duration(5 * time.Second),
+		Retries:     3,
+		RetryDelay:  duration(200 * time.Millisecond),
+		Providers: []providerScript{
+			{
+				Name: "default", Priority: 0, Fee: 0.05,
+				behavior: behavior{LatencyMs: f(15), JitterMs: f(5), ErrorRate: f(0.01)},
+				Phases: []phase{
+					{From: duration(15 * time.Second), To: duration(25 * time.Second), behavior: behavior{Failing: &yes}},
+					{From: duration(25 * time.Second), To: duration(40 * time.Second), behavior: behavior{LatencyMs: f(300), JitterMs: f(120)}},
+				},
+			},
+			{
+				Name: "fallback", Priority: 1, Fee: 0.15,
+				behavior: behavior{LatencyMs: f(40), JitterMs: f(10), ErrorRate: f(0.02)},
+			},
+		},
+	}
+}
+
+func loadScenario(path string) (scenario, error) {
+	sc := defaultScenario()
+	if path == "" {
+		return sc, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return scenario{}, err
+	}
+	sc.Providers = nil
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return scenario{}, err
+	}
+	if len(sc.Providers) == 0 {
+		return scenario{}, fmt.Errorf("%s: no providers", path)
+	}
+	return sc, nil
+}
+
+// at resolve o comportamento do provider no instante t (desde o início).
+func (p providerScript) at(t time.Duration) (lat, jitter, errRate float64, failing bool) {
+	b := p.behavior
+	for _, ph := range p.Phases {
+		if t < time.Duration(ph.From) || t >= time.Duration(ph.To) {
+			continue
+		}
+		if ph.LatencyMs != nil {
+			b.LatencyMs = ph.LatencyMs
+		}
+		if ph.JitterMs != nil {
+			b.JitterMs = ph.JitterMs
+		}
+		if ph.ErrorRate != nil {
+			b.ErrorRate = ph.ErrorRate
+		}
+		if ph.Failing != nil {
+			b.Failing = ph.Failing
+		}
+	}
+	return deref(b.LatencyMs), deref(b.JitterMs), deref(b.ErrorRate), b.Failing != nil && *b.Failing
+}
+
+// call sorteia uma chamada Pay: duração observada e se falhou.
+func (p providerScript) call(rng *rand.Rand, t time.Duration, timeoutMs float64) (time.Duration, bool) {
+	lat, jitter, errRate, failing := p.at(t)
+	ms := lat + rng.NormFloat64()*jitter
+	if ms < 1 {
+		ms = 1
+	}
+	if timeoutMs > 0 && ms > timeoutMs {
+		return time.Duration(timeoutMs * float64(time.Millisecond)), true
+	}
+	failed := failing || rng.Float64() < errRate
+	return time.Duration(ms * float64(time.Millisecond)), failed
+}
+
+func deref(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
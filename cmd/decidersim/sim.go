@@ -0,0 +1,168 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/decider"
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/shopspring/decimal"
+)
+
+var errSim = errors.New("simulated failure")
+
+type eventKind int
+
+const (
+	evArrival eventKind = iota // nova tentativa de um pagamento
+	evDone                     // resposta do provider
+	evHealth                   // tick do health check
+)
+
+type event struct {
+	at       time.Duration
+	kind     eventKind
+	attempt  int
+	provider decider.Provider
+	lat      time.Duration
+	failed   bool
+}
+
+type eventQueue []event
+
+func (q eventQueue) Len() int           { return len(q) }
+func (q eventQueue) Less(i, j int) bool { return q[i].at < q[j].at }
+func (q eventQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x any)        { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() any {
+	old := *q
+	ev := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return ev
+}
+
+type providerStats struct {
+	Calls     int64
+	Succeeded int64
+	Failed    int64
+	Fees      float64
+	latencies []float64 // ms
+	Breaker   map[decider.BreakerState]int64
+}
+
+type result struct {
+	Payments  int64
+	Processed int64
+	Lost      int64 // esgotou as tentativas
+	Providers map[decider.Provider]*providerStats
+	Order     []decider.Provider
+}
+
+// simulate roda o cenário em tempo virtual: o Decider lê o relógio do simulador e
+// nenhum sleep real acontece.
+func simulate(sc scenario, strategy decider.Strategy, bcfg decider.BreakerConfig, seed uint64) (result, error) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var now time.Duration
+	clock := func() time.Time { return start.Add(now) }
+
+	specs := make([]processors.Spec, 0, len(sc.Providers))
+	scripts := make(map[decider.Provider]providerScript, len(sc.Providers))
+	for _, p := range sc.Providers {
+		specs = append(specs, processors.Spec{
+			Name: processors.Provider(p.Name), BaseURL: "sim://" + p.Name,
+			Priority: p.Priority, Fee: p.Fee, FeeFixed: p.FeeFixed,
+		})
+		scripts[decider.Provider(p.Name)] = p
+	}
+	reg, err := processors.NewRegistry(specs)
+	if err != nil {
+		return result{}, err
+	}
+	d := decider.NewWithOptions(reg, strategy, decider.Options{Now: clock, Breaker: bcfg})
+
+	res := result{Providers: map[decider.Provider]*providerStats{}}
+	for _, s := range reg.All() {
+		p := decider.Provider(s.Name)
+		res.Order = append(res.Order, p)
+		res.Providers[p] = &providerStats{Breaker: map[decider.BreakerState]int64{}}
+	}
+	d.OnBreakerChange(func(ev decider.BreakerEvent) {
+		if st := res.Providers[ev.Provider]; st != nil {
+			st.Breaker[ev.To]++
+		}
+	})
+
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	amount := decimal.NewFromFloat(sc.Amount)
+	end := time.Duration(sc.Duration)
+	step := time.Duration(float64(time.Second) / sc.RPS)
+
+	q := &eventQueue{{at: 0, kind: evArrival}, {at: 0, kind: evHealth}}
+	nextArrival := step
+	for q.Len() > 0 {
+		ev := heap.Pop(q).(event)
+		now = ev.at
+
+		switch ev.kind {
+		case evArrival:
+			if ev.attempt == 0 {
+				res.Payments++
+				if nextArrival < end {
+					heap.Push(q, event{at: nextArrival, kind: evArrival})
+					nextArrival += step
+				}
+			}
+			p := decider.Provider(d.Choose(amount))
+			lat, failed := scripts[p].call(rng, now, sc.TimeoutMs)
+			heap.Push(q, event{at: now + lat, kind: evDone, attempt: ev.attempt, provider: p, lat: lat, failed: failed})
+
+		case evDone:
+			var err error
+			if ev.failed {
+				err = errSim
+			}
+			d.Observe(ev.provider, ev.lat, err)
+
+			st := res.Providers[ev.provider]
+			st.Calls++
+			st.latencies = append(st.latencies, float64(ev.lat)/float64(time.Millisecond))
+			if !ev.failed {
+				st.Succeeded++
+				res.Processed++
+				sp := scripts[ev.provider]
+				st.Fees += sc.Amount*sp.Fee + sp.FeeFixed
+				continue
+			}
+			st.Failed++
+			if ev.attempt < sc.Retries {
+				heap.Push(q, event{at: now + time.Duration(sc.RetryDelay), kind: evArrival, attempt: ev.attempt + 1})
+			} else {
+				res.Lost++
+			}
+
+		case evHealth:
+			for p, s := range scripts {
+				lat, _, _, failing := s.at(now)
+				d.UpdateHealth(p, failing, int(lat))
+			}
+			if next := now + time.Duration(sc.HealthEvery); next < end && sc.HealthEvery > 0 {
+				heap.Push(q, event{at: next, kind: evHealth})
+			}
+		}
+	}
+
+	for _, st := range res.Providers {
+		sort.Float64s(st.latencies)
+	}
+	return res, nil
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
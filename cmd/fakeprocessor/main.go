@@ -0,0 +1,67 @@
+// Comando fakeprocessor: substituto local dos payment processors da Rinha
+// (payment-processor-default/-fallback), com injeção de falhas controlável em runtime.
+//
+//	fakeprocessor -addr :8001 -fee 0.05 -delay 20ms -error-rate 0.1
+//
+// Contrato dos processors:
+//
+//	POST /payments                    { correlationId, amount, requestedAt }
+//	GET  /payments/{id}               200 se já processado, 404 se não
+//	GET  /payments/service-health     { failing, minResponseTime } (429 se chamado < 5s)
+//	POST /refunds                     { refundId, correlationId, amount, requestedAt }
+//	GET  /admin/payments-summary      ?from=&to= (header X-Rinha-Token)
+//
+// Controle (header X-Rinha-Token):
+//
+//	GET|PUT /admin/configurations     todas as opções abaixo (PUT aceita parcial)
+//	PUT /admin/configurations/delay   { "delay": ms }
+//	PUT /admin/configurations/failure { "failure": bool }
+//	PUT /admin/configurations/token   { "token": "..." }
+//	POST /admin/purge-payments
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func main() {
+	addr := flag.String("addr", ":8001", "endereço de escuta")
+	fee := flag.Float64("fee", 0.05, "fee por transação (fração do valor)")
+	token := flag.String("token", "123", "X-Rinha-Token dos endpoints /admin")
+	healthEvery := flag.Duration("health-limit", 5*time.Second, "intervalo mínimo entre service-health (0 desliga o 429)")
+	var s settings
+	flag.IntVar(&s.DelayMs, "delay", 0, "latência base em ms")
+	flag.IntVar(&s.JitterMs, "jitter", 0, "latência extra uniforme em [0, jitter) ms")
+	flag.Float64Var(&s.ErrorRate, "error-rate", 0, "fração de requisições que respondem 500 sem processar")
+	flag.BoolVar(&s.Failing, "failing", false, "começa fora do ar (500 em tudo, health failing)")
+	flag.Float64Var(&s.TimeoutRate, "timeout-rate", 0, "fração de pagamentos aceitos que só respondem depois de -timeout-delay")
+	flag.IntVar(&s.TimeoutDelayMs, "timeout-delay", 2000, "atraso em ms das respostas aceitas-mas-atrasadas")
+	flag.Parse()
+
+	p := newProcessor(*fee, *token, *healthEvery, s)
+
+	r := chi.NewRouter()
+	r.Post("/payments", p.pay)
+	r.Get("/payments/service-health", p.health)
+	r.Get("/payments/{id}", p.getPayment)
+	r.Post("/refunds", p.refund)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(p.auth)
+		r.Get("/payments-summary", p.summary)
+		r.Get("/configurations", p.getConfig)
+		r.Put("/configurations", p.putConfig)
+		r.Put("/configurations/delay", p.putDelay)
+		r.Put("/configurations/failure", p.putFailure)
+		r.Put("/configurations/token", p.putToken)
+		r.Post("/purge-payments", p.purge)
+	})
+
+	log.Printf("fakeprocessor listening on %s (fee %.4f)", *addr, *fee)
+	srv := &http.Server{Addr: *addr, Handler: r, ReadHeaderTimeout: 5 * time.Second}
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/shopspring/decimal"
+)
+
+// settings: comportamento alterável em runtime via /admin/configurations
+type settings struct {
+	DelayMs        int     `json:"delayMs"`
+	JitterMs       int     `json:"jitterMs"`
+	ErrorRate      float64 `json:"errorRate"`
+	Failing        bool    `json:"failing"`
+	TimeoutRate    float64 `json:"timeoutRate"`    // aceita, grava e só responde após TimeoutDelayMs
+	TimeoutDelayMs int     `json:"timeoutDelayMs"` // acima do timeout do cliente (550ms)
+}
+
+type payment struct {
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Amount        decimal.Decimal `json:"amount"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+}
+
+type refund struct {
+	RefundID      uuid.UUID       `json:"refundId"`
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Amount        decimal.Decimal `json:"amount"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+}
+
+type processor struct {
+	fee         decimal.Decimal
+	healthEvery time.Duration
+
+	mu         sync.Mutex
+	token      string
+	cfg        settings
+	payments   map[uuid.UUID]payment
+	refunds    map[uuid.UUID]refund
+	refunded   map[uuid.UUID]decimal.Decimal // por correlationId
+	lastHealth time.Time
+}
+
+func newProcessor(fee float64, token string, healthEvery time.Duration, s settings) *processor {
+	return &processor{
+		fee:         decimal.NewFromFloat(fee),
+		healthEvery: healthEvery,
+		token:       token,
+		cfg:         s,
+		payments:    map[uuid.UUID]payment{},
+		refunds:     map[uuid.UUID]refund{},
+		refunded:    map[uuid.UUID]decimal.Decimal{},
+	}
+}
+
+func (p *processor) settings() settings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg
+}
+
+// latency aplica delay + jitter; false se o cliente desistiu antes.
+func (p *processor) latency(r *http.Request, s settings) bool {
+	d := time.Duration(s.DelayMs) * time.Millisecond
+	if s.JitterMs > 0 {
+		d += time.Duration(rand.IntN(s.JitterMs)) * time.Millisecond
+	}
+	return sleep(r, d)
+}
+
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// fault: failing ou sorteio de erro -> 500 sem processar.
+func (p *processor) fault(w http.ResponseWriter, s settings) bool {
+	if s.Failing || (s.ErrorRate > 0 && rand.Float64() < s.ErrorRate) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+	return false
+}
+
+func (p *processor) pay(w http.ResponseWriter, r *http.Request) {
+	var in payment
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.CorrelationID == uuid.Nil || !in.Amount.IsPositive() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s := p.settings()
+	if !p.latency(r, s) || p.fault(w, s) {
+		return
+	}
+	if in.RequestedAt.IsZero() {
+		in.RequestedAt = time.Now().UTC()
+	}
+
+	p.mu.Lock()
+	_, dup := p.payments[in.CorrelationID]
+	if !dup {
+		p.payments[in.CorrelationID] = in
+	}
+	p.mu.Unlock()
+	if dup {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "CorrelationId already exists"})
+		return
+	}
+
+	// aceito-mas-atrasado: já está gravado, mas o cliente só vê timeout
+	if s.TimeoutRate > 0 && rand.Float64() < s.TimeoutRate {
+		if !sleep(r, time.Duration(s.TimeoutDelayMs)*time.Millisecond) {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "payment processed successfully"})
+}
+
+func (p *processor) getPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s := p.settings()
+	if !p.latency(r, s) {
+		return
+	}
+	p.mu.Lock()
+	pm, ok := p.payments[id]
+	p.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, pm)
+}
+
+func (p *processor) health(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	now := time.Now()
+	limited := p.healthEvery > 0 && now.Sub(p.lastHealth) < p.healthEvery
+	if !limited {
+		p.lastHealth = now
+	}
+	s := p.cfg
+	p.mu.Unlock()
+	if limited {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"failing": s.Failing, "minResponseTime": s.DelayMs})
+}
+
+func (p *processor) refund(w http.ResponseWriter, r *http.Request) {
+	var in refund
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.RefundID == uuid.Nil || !in.Amount.IsPositive() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s := p.settings()
+	if !p.latency(r, s) || p.fault(w, s) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.refunds[in.RefundID]; ok {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "refund already processed"})
+		return
+	}
+	pm, ok := p.payments[in.CorrelationID]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if p.refunded[in.CorrelationID].Add(in.Amount).GreaterThan(pm.Amount) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "refund exceeds payment amount"})
+		return
+	}
+	p.refunds[in.RefundID] = in
+	p.refunded[in.CorrelationID] = p.refunded[in.CorrelationID].Add(in.Amount)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "refund processed successfully"})
+}
+
+func (p *processor) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		token := p.token
+		p.mu.Unlock()
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Rinha-Token")), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *processor) summary(w http.ResponseWriter, r *http.Request) {
+	from, to := repo.ParseISO(r.URL.Query().Get("from")), repo.ParseISO(r.URL.Query().Get("to"))
+
+	p.mu.Lock()
+	var count int64
+	total := decimal.Zero
+	for _, pm := range p.payments {
+		if (from != nil && pm.RequestedAt.Before(*from)) || (to != nil && pm.RequestedAt.After(*to)) {
+			continue
+		}
+		count++
+		total = total.Add(pm.Amount)
+	}
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"totalRequests":     count,
+		"totalAmount":       total,
+		"totalFee":          total.Mul(p.fee).Round(2),
+		"feePerTransaction": p.fee,
+	})
+}
+
+func (p *processor) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.settings())
+}
+
+// putConfig: campos ausentes mantêm o valor atual.
+func (p *processor) putConfig(w http.ResponseWriter, r *http.Request) {
+	next := p.settings()
+	if err := json.NewDecoder(r.Body).Decode(&next); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.cfg = next
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, next)
+}
+
+func (p *processor) putDelay(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Delay int `json:"delay"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Delay < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.cfg.DelayMs = in.Delay
+	p.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *processor) putFailure(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Failure bool `json:"failure"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.cfg.Failing = in.Failure
+	p.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *processor) putToken(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.token = in.Token
+	p.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *processor) purge(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.payments = map[uuid.UUID]payment{}
+	p.refunds = map[uuid.UUID]refund{}
+	p.refunded = map[uuid.UUID]decimal.Decimal{}
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"message": "All payments purged."})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var minAmount = decimal.NewFromFloat(0.01)
+
+// amountDist: valores em reais, arredondados para centavos e nunca abaixo de 0.01.
+type amountDist struct {
+	kind string
+	a, b float64
+}
+
+func parseDist(spec string) (amountDist, error) {
+	kind, rest, _ := strings.Cut(spec, ":")
+	var params []float64
+	for _, s := range strings.Split(rest, ",") {
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return amountDist{}, fmt.Errorf("%q: %w", spec, err)
+		}
+		params = append(params, v)
+	}
+	want := map[string]int{"fixed": 1, "uniform": 2, "normal": 2, "lognormal": 2}
+	n, ok := want[kind]
+	if !ok {
+		return amountDist{}, fmt.Errorf("unknown distribution %q", kind)
+	}
+	if len(params) != n {
+		return amountDist{}, fmt.Errorf("%s takes %d parameter(s), got %d", kind, n, len(params))
+	}
+	d := amountDist{kind: kind, a: params[0]}
+	if n == 2 {
+		d.b = params[1]
+	}
+	return d, nil
+}
+
+func (d amountDist) sample() decimal.Decimal {
+	var v float64
+	switch d.kind {
+	case "fixed":
+		v = d.a
+	case "uniform":
+		v = d.a + rand.Float64()*(d.b-d.a)
+	case "normal":
+		v = d.a + rand.NormFloat64()*d.b
+	case "lognormal":
+		v = math.Exp(d.a + rand.NormFloat64()*d.b)
+	}
+	out := decimal.NewFromFloat(v).Round(2)
+	if out.LessThan(minAmount) {
+		return minAmount
+	}
+	return out
+}
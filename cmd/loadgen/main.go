@@ -0,0 +1,156 @@
+// Comando loadgen: gera tráfego de POST /payments, grava o que mandou em JSONL,
+// reenvia um JSONL gravado e confere /payments-summary contra o que foi aceito.
+//
+//	loadgen run    [-target URL] [-rps N] [-duration D] [-amount DIST] [-dup R] [-record F] [-verify]
+//	loadgen replay [-target URL] [-rps N] [-verify] <arquivo.jsonl>
+//
+// DIST: fixed:19.90 | uniform:1,100 | normal:50,15 | lognormal:3,0.8
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// record: uma linha do JSONL (offset relativo ao início da rodada)
+type record struct {
+	OffsetMs      int64           `json:"offsetMs"`
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Amount        decimal.Decimal `json:"amount"`
+	Duplicate     bool            `json:"duplicate,omitempty"`
+	Status        int             `json:"status,omitempty"`
+	LatencyMs     float64         `json:"latencyMs,omitempty"`
+}
+
+type common struct {
+	target      string
+	rps         float64
+	concurrency int
+	verify      bool
+	settle      time.Duration
+}
+
+// register: rps tem default por modo (run gera a 100 rps; replay mantém os offsets gravados).
+func (c *common) register(fs *flag.FlagSet, rps float64, rpsUsage string) {
+	fs.StringVar(&c.target, "target", "http://localhost:9999", "URL base da API")
+	fs.Float64Var(&c.rps, "rps", rps, rpsUsage)
+	fs.IntVar(&c.concurrency, "concurrency", 256, "máximo de requisições em voo")
+	fs.BoolVar(&c.verify, "verify", true, "confere /payments-summary ao final")
+	fs.DurationVar(&c.settle, "settle", 15*time.Second, "quanto esperar o summary convergir")
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "run":
+		cmdRun(os.Args[2:])
+	case "replay":
+		cmdReplay(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func cmdRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var c common
+	c.register(fs, 100, "requisições por segundo")
+	duration := fs.Duration("duration", 30*time.Second, "duração da rodada")
+	amountSpec := fs.String("amount", "fixed:19.90", "distribuição dos valores")
+	dupRatio := fs.Float64("dup", 0, "fração de requisições que repetem um correlationId já enviado")
+	recordPath := fs.String("record", "", "grava as requisições enviadas neste JSONL")
+	_ = fs.Parse(args)
+
+	dist, err := parseDist(*amountSpec)
+	if err != nil {
+		log.Fatalf("amount: %v", err)
+	}
+	if c.rps <= 0 {
+		log.Fatal("rps must be > 0")
+	}
+
+	// plano completo antes de enviar: o ritmo não depende da geração
+	n := int(c.rps * duration.Seconds())
+	plan := make([]record, 0, n)
+	for i := 0; i < n; i++ {
+		off := int64(float64(i) / c.rps * 1000)
+		if len(plan) > 0 && rand.Float64() < *dupRatio {
+			prev := plan[rand.IntN(len(plan))]
+			plan = append(plan, record{OffsetMs: off, CorrelationID: prev.CorrelationID, Amount: prev.Amount, Duplicate: true})
+			continue
+		}
+		plan = append(plan, record{OffsetMs: off, CorrelationID: uuid.New(), Amount: dist.sample()})
+	}
+
+	var rec *recorder
+	if *recordPath != "" {
+		if rec, err = newRecorder(*recordPath); err != nil {
+			log.Fatalf("record: %v", err)
+		}
+	}
+	execute(c, plan, false, rec)
+}
+
+func cmdReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var c common
+	c.register(fs, 0, "reenvia neste ritmo em vez dos offsets gravados (0 = mantém os offsets)")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	plan, err := readRecords(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if c.rps > 0 {
+		for i := range plan {
+			plan[i].OffsetMs = int64(float64(i) / c.rps * 1000)
+		}
+	}
+	execute(c, plan, true, nil)
+}
+
+func readRecords(path string) ([]record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []record
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		r.Status, r.LatencyMs = 0, 0
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  loadgen run    [-target URL] [-rps N] [-duration D] [-amount DIST] [-dup R] [-record F] [-verify]")
+	fmt.Fprintln(os.Stderr, "  loadgen replay [-target URL] [-rps N] [-verify] <arquivo.jsonl>")
+	fmt.Fprintln(os.Stderr, "  DIST: fixed:19.90 | uniform:1,100 | normal:50,15 | lognormal:3,0.8")
+	os.Exit(2)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// recorder: grava os records em ordem de envio; execute só chama write depois que
+// todas as requisições terminaram, na ordem do plano (status/latência já preenchidos)
+type recorder struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (r *recorder) write(rec record) {
+	b, _ := json.Marshal(rec)
+	_, _ = r.w.Write(append(b, '\n'))
+}
+
+func (r *recorder) close() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	return r.f.Close()
+}
+
+type totals struct {
+	count  int64
+	amount decimal.Decimal
+}
+
+// execute envia o plano no ritmo dos offsets e, com verify, confere o summary.
+func execute(c common, plan []record, replay bool, rec *recorder) {
+	httpc := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: c.concurrency, MaxConnsPerHost: c.concurrency},
+	}
+	endpoint := c.target + "/payments"
+
+	var (
+		mu        sync.Mutex
+		codes     = map[int]int{}
+		latencies = make([]float64, 0, len(plan))
+		sent      = make([]record, len(plan))       // resultado por posição do plano
+		accepted  = map[uuid.UUID]decimal.Decimal{} // 2xx: o que deve aparecer no summary
+	)
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+
+	from := time.Now().UTC()
+	start := time.Now()
+	for i, r := range plan {
+		if d := time.Until(start.Add(time.Duration(r.OffsetMs) * time.Millisecond)); d > 0 {
+			time.Sleep(d)
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, r record) {
+			defer func() { <-sem; wg.Done() }()
+			body, _ := json.Marshal(map[string]any{"correlationId": r.CorrelationID, "amount": r.Amount})
+			t0 := time.Now()
+			resp, err := httpc.Post(endpoint, "application/json", bytes.NewReader(body))
+			r.LatencyMs = float64(time.Since(t0).Microseconds()) / 1000
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				r.Status = resp.StatusCode
+			}
+
+			mu.Lock()
+			codes[r.Status]++
+			latencies = append(latencies, r.LatencyMs)
+			if r.Status/100 == 2 {
+				if _, ok := accepted[r.CorrelationID]; !ok {
+					accepted[r.CorrelationID] = r.Amount
+				}
+			}
+			mu.Unlock()
+			sent[i] = r
+		}(i, r)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if rec != nil {
+		for _, r := range sent {
+			rec.write(r)
+		}
+		if err := rec.close(); err != nil {
+			log.Printf("record: %v", err)
+		}
+	}
+
+	mode := "run"
+	if replay {
+		mode = "replay"
+	}
+	log.Printf("%s: %d requests in %s (%.1f rps)", mode, len(plan), elapsed.Round(time.Millisecond), float64(len(plan))/elapsed.Seconds())
+	printCodes(codes)
+	sort.Float64s(latencies)
+	log.Printf("latency ms: p50=%.2f p90=%.2f p99=%.2f max=%.2f",
+		pct(latencies, 0.50), pct(latencies, 0.90), pct(latencies, 0.99), pct(latencies, 1))
+
+	if !c.verify {
+		return
+	}
+	want := totals{amount: decimal.Zero}
+	for _, amt := range accepted {
+		want.count++
+		want.amount = want.amount.Add(amt)
+	}
+	if !verify(httpc, c.target, from, want, c.settle) {
+		os.Exit(1)
+	}
+}
+
+// verify espera o summary da janela da rodada bater com o que foi aceito.
+func verify(httpc *http.Client, target string, from time.Time, want totals, settle time.Duration) bool {
+	deadline := time.Now().Add(settle)
+	var got totals
+	for {
+		to := time.Now().UTC().Add(time.Second)
+		var err error
+		got, err = fetchSummary(httpc, target, from, to)
+		if err != nil {
+			log.Printf("verify: summary: %v", err)
+		} else if got.count == want.count && got.amount.Equal(want.amount) {
+			log.Printf("verify: OK (%d payments, %s)", got.count, got.amount)
+			return true
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	log.Printf("verify: MISMATCH summary=%d/%s expected=%d/%s", got.count, got.amount, want.count, want.amount)
+	return false
+}
+
+func fetchSummary(httpc *http.Client, target string, from, to time.Time) (totals, error) {
+	q := url.Values{}
+	q.Set("from", from.Format(time.RFC3339Nano))
+	q.Set("to", to.Format(time.RFC3339Nano))
+	resp, err := httpc.Get(target + "/payments-summary?" + q.Encode())
+	if err != nil {
+		return totals{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return totals{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var out map[string]struct {
+		TotalRequests int64           `json:"totalRequests"`
+		TotalAmount   decimal.Decimal `json:"totalAmount"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return totals{}, err
+	}
+	sum := totals{amount: decimal.Zero}
+	for _, p := range out {
+		sum.count += p.TotalRequests
+		sum.amount = sum.amount.Add(p.TotalAmount)
+	}
+	return sum, nil
+}
+
+func printCodes(codes map[int]int) {
+	keys := make([]int, 0, len(codes))
+	for k := range codes {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		label := fmt.Sprint(k)
+		if k == 0 {
+			label = "error"
+		}
+		log.Printf("  %s: %d", label, codes[k])
+	}
+}
+
+func pct(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(sorted)-1))
+	return sorted[i]
+}
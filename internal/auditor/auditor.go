@@ -0,0 +1,148 @@
+package auditor
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/shopspring/decimal"
+)
+
+// lockKey: advisory lock do job periódico (chave própria; o health worker usa outra).
+const lockKey int64 = 987654322
+
+type Options struct {
+	Every  time.Duration // intervalo entre rodadas; 0 desliga o job (consulta sob demanda continua)
+	Window time.Duration // tamanho da janela comparada
+	Lag    time.Duration // a janela termina em now-Lag, para itens em voo assentarem
+}
+
+// ProviderReport: nosso repo.Summary contra o admin summary do processor.
+type ProviderReport struct {
+	Provider       repo.Provider   `json:"provider"`
+	LocalRequests  int64           `json:"localRequests"`
+	LocalAmount    decimal.Decimal `json:"localAmount"`
+	RemoteRequests int64           `json:"remoteRequests"`
+	RemoteAmount   decimal.Decimal `json:"remoteAmount"`
+	RemoteFee      decimal.Decimal `json:"remoteFee"`
+	DiffRequests   int64           `json:"diffRequests"` // remoto - local
+	DiffAmount     decimal.Decimal `json:"diffAmount"`
+	Match          bool            `json:"match"`
+	Error          string          `json:"error,omitempty"`
+}
+
+type Report struct {
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	At        time.Time        `json:"at"`
+	Match     bool             `json:"match"`
+	Providers []ProviderReport `json:"providers"`
+}
+
+// Auditor compara o que gravamos com o que cada processor diz ter cobrado.
+type Auditor struct {
+	db   repo.DB
+	proc *processors.Client
+	opts Options
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func New(db repo.DB, proc *processors.Client, opts Options) *Auditor {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	return &Auditor{db: db, proc: proc, opts: opts}
+}
+
+// Start roda a reconciliação a cada Every sobre [now-Lag-Window, now-Lag], só na
+// instância que pegar o advisory lock (mesmo esquema do health worker). Run sob
+// demanda (/admin/reconciliation) não passa pelo lock.
+func (a *Auditor) Start(ctx context.Context) {
+	if a.opts.Every <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(a.opts.Every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				a.runLocked(ctx)
+			}
+		}
+	}()
+}
+
+func (a *Auditor) runLocked(ctx context.Context) {
+	ok, err := a.db.TryGlobalLock(ctx, lockKey)
+	if err != nil {
+		log.Printf("audit lock err: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer a.db.UnlockGlobal(ctx, lockKey)
+	to := time.Now().Add(-a.opts.Lag)
+	a.Run(ctx, to.Add(-a.opts.Window), to)
+}
+
+// Run compara a janela [from, to] em todos os providers, loga divergências e
+// guarda o relatório como o último.
+func (a *Auditor) Run(ctx context.Context, from, to time.Time) Report {
+	rep := Report{From: from.UTC(), To: to.UTC(), At: time.Now().UTC(), Match: true}
+	for _, p := range a.proc.Registry().Names() {
+		pr := a.compare(ctx, p, from, to)
+		if !pr.Match {
+			rep.Match = false
+			if pr.Error != "" {
+				log.Printf("audit %s [%s, %s]: %s", p, rep.From.Format(time.RFC3339), rep.To.Format(time.RFC3339), pr.Error)
+			} else {
+				log.Printf("audit %s [%s, %s]: drift requests=%+d amount=%s (local %d/%s, remote %d/%s)",
+					p, rep.From.Format(time.RFC3339), rep.To.Format(time.RFC3339),
+					pr.DiffRequests, pr.DiffAmount, pr.LocalRequests, pr.LocalAmount, pr.RemoteRequests, pr.RemoteAmount)
+			}
+		}
+		rep.Providers = append(rep.Providers, pr)
+	}
+
+	a.mu.Lock()
+	a.last = &rep
+	a.mu.Unlock()
+	return rep
+}
+
+// Last devolve o último relatório (nil se nenhuma rodada terminou ainda).
+func (a *Auditor) Last() *Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last
+}
+
+func (a *Auditor) compare(ctx context.Context, p processors.Provider, from, to time.Time) ProviderReport {
+	pr := ProviderReport{Provider: repo.Provider(p)}
+	cnt, amt, err := a.db.Summary(ctx, repo.Provider(p), &from, &to)
+	if err != nil {
+		pr.Error = "local summary: " + err.Error()
+		return pr
+	}
+	pr.LocalRequests, pr.LocalAmount = cnt, amt
+
+	remote, err := a.proc.AdminSummary(ctx, p, from, to)
+	if err != nil {
+		pr.Error = "admin summary: " + err.Error()
+		return pr
+	}
+	pr.RemoteRequests, pr.RemoteAmount, pr.RemoteFee = remote.TotalRequests, remote.TotalAmount, remote.TotalFee
+	pr.DiffRequests = pr.RemoteRequests - pr.LocalRequests
+	pr.DiffAmount = pr.RemoteAmount.Sub(pr.LocalAmount)
+	pr.Match = pr.DiffRequests == 0 && pr.DiffAmount.IsZero()
+	return pr
+}
@@ -0,0 +1,60 @@
+package auditor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+)
+
+func testAuditor(t *testing.T, db repo.DB) *Auditor {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(processors.AdminSummaryInfo{})
+	}))
+	t.Cleanup(srv.Close)
+	reg, err := processors.NewRegistry([]processors.Spec{{Name: "default", BaseURL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(db, processors.NewClient(reg), Options{Every: 5 * time.Millisecond})
+}
+
+func TestStartRunsOnlyWithLock(t *testing.T) {
+	db := repo.NewMemDB()
+	ctx := context.Background()
+	// outra instância segurando o lock do job
+	if ok, _ := db.TryGlobalLock(ctx, lockKey); !ok {
+		t.Fatal("lock not acquired")
+	}
+	a := testAuditor(t, db)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.Start(runCtx)
+
+	time.Sleep(50 * time.Millisecond)
+	if a.Last() != nil {
+		t.Fatal("audit ran without the lock")
+	}
+
+	// sob demanda não depende do lock
+	now := time.Now()
+	manual := a.Run(ctx, now.Add(-time.Minute), now)
+	if !manual.Match || len(manual.Providers) != 1 {
+		t.Fatalf("on-demand report = %+v", manual)
+	}
+
+	_ = db.UnlockGlobal(ctx, lockKey)
+	deadline := time.Now().Add(time.Second)
+	for last := a.Last(); last == nil || last.At.Equal(manual.At); last = a.Last() {
+		if time.Now().After(deadline) {
+			t.Fatal("audit did not run after the lock was released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
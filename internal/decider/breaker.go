@@ -0,0 +1,164 @@
+package decider
+
+import "time"
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerEvent é emitido a cada transição de estado do breaker de um provider.
+type BreakerEvent struct {
+	Provider Provider
+	From, To BreakerState
+	At       time.Time
+	Until    time.Time // fim do período aberto (só para To == BreakerOpen)
+	FailRate float64   // taxa da janela no momento da transição (quando aplicável)
+	Remote   bool      // aplicado a partir do estado compartilhado por outra instância
+}
+
+type breakerConfig struct {
+	window      int           // tamanho da janela deslizante (em chamadas)
+	minSamples  int           // mínimo de amostras na janela para avaliar
+	failRate    float64       // taxa que abre o breaker
+	openFor     time.Duration // tempo aberto antes do half-open
+	halfOpenMax int           // chamadas de teste permitidas no half-open
+}
+
+// breaker: closed/open/half-open com janela deslizante de resultados.
+// Não é seguro para uso concorrente; o Decider serializa o acesso.
+type breaker struct {
+	cfg   breakerConfig
+	state BreakerState
+
+	ring  []bool // true = falha
+	next  int
+	n     int
+	fails int
+
+	openUntil time.Time
+	admitted  int // chamadas liberadas no half-open
+	trialOK   int // sucessos no half-open
+}
+
+func newBreaker(cfg breakerConfig) *breaker {
+	return &breaker{cfg: cfg, ring: make([]bool, cfg.window)}
+}
+
+func (b *breaker) failRate() float64 {
+	if b.n == 0 {
+		return 0
+	}
+	return float64(b.fails) / float64(b.n)
+}
+
+// advance move open -> half-open quando o timeout expira.
+func (b *breaker) advance(now time.Time) (BreakerEvent, bool) {
+	if b.state == BreakerOpen && !now.Before(b.openUntil) {
+		return b.transition(BreakerHalfOpen, now), true
+	}
+	return BreakerEvent{}, false
+}
+
+// blocked: aberto, ou half-open já com todas as chamadas de teste liberadas.
+func (b *breaker) blocked() bool {
+	switch b.state {
+	case BreakerOpen:
+		return true
+	case BreakerHalfOpen:
+		return b.admitted >= b.cfg.halfOpenMax
+	}
+	return false
+}
+
+// admit contabiliza uma chamada de teste quando escolhido em half-open.
+func (b *breaker) admit() {
+	if b.state == BreakerHalfOpen {
+		b.admitted++
+	}
+}
+
+// unadmit devolve uma chamada de teste liberada mas não feita.
+func (b *breaker) unadmit() {
+	if b.state == BreakerHalfOpen && b.admitted > 0 {
+		b.admitted--
+	}
+}
+
+func (b *breaker) record(failed bool, now time.Time) (BreakerEvent, bool) {
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			return b.trip(now), true
+		}
+		b.trialOK++
+		if b.trialOK >= b.cfg.halfOpenMax {
+			return b.transition(BreakerClosed, now), true
+		}
+	case BreakerClosed:
+		if b.n == len(b.ring) {
+			if b.ring[b.next] {
+				b.fails--
+			}
+		} else {
+			b.n++
+		}
+		b.ring[b.next] = failed
+		if failed {
+			b.fails++
+		}
+		b.next = (b.next + 1) % len(b.ring)
+		if b.n >= b.cfg.minSamples && b.failRate() >= b.cfg.failRate {
+			return b.trip(now), true
+		}
+	}
+	// open: respostas atrasadas de antes da abertura não mudam o estado
+	return BreakerEvent{}, false
+}
+
+func (b *breaker) trip(now time.Time) BreakerEvent {
+	ev := b.transition(BreakerOpen, now)
+	b.openUntil = now.Add(b.cfg.openFor)
+	ev.Until = b.openUntil
+	return ev
+}
+
+// forceOpen abre (ou estende) o breaker até until, vindo de outra instância.
+func (b *breaker) forceOpen(until, now time.Time) (BreakerEvent, bool) {
+	if !until.After(now) || (b.state == BreakerOpen && !until.After(b.openUntil)) {
+		return BreakerEvent{}, false
+	}
+	if b.state == BreakerOpen {
+		b.openUntil = until
+		return BreakerEvent{}, false
+	}
+	ev := b.transition(BreakerOpen, now)
+	b.openUntil = until
+	ev.Until = until
+	return ev, true
+}
+
+func (b *breaker) transition(to BreakerState, now time.Time) BreakerEvent {
+	ev := BreakerEvent{From: b.state, To: to, At: now, FailRate: b.failRate()}
+	b.state = to
+	b.admitted, b.trialOK = 0, 0
+	if to != BreakerOpen {
+		// janela nova a cada (re)fechamento/half-open
+		b.n, b.fails, b.next = 0, 0, 0
+	}
+	return ev
+}
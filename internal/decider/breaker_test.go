@@ -0,0 +1,154 @@
+package decider
+
+import (
+	"testing"
+	"time"
+)
+
+func testBreaker() *breaker {
+	return newBreaker(breakerConfig{window: 10, minSamples: 4, failRate: 0.5, openFor: time.Second, halfOpenMax: 2})
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	type step struct {
+		op     string // "ok", "fail", "advance", "admit", "unadmit"
+		at     time.Duration
+		want   BreakerState
+		event  bool // houve transição
+		blocks bool
+	}
+	cases := []struct {
+		name  string
+		steps []step
+	}{
+		{"stays closed below min samples", []step{
+			{op: "fail", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+		}},
+		{"opens at fail rate once min samples reached", []step{
+			{op: "ok", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+			{op: "ok", want: BreakerClosed},
+			{op: "fail", want: BreakerOpen, event: true, blocks: true},
+		}},
+		{"stays closed under fail rate", []step{
+			{op: "ok", want: BreakerClosed},
+			{op: "ok", want: BreakerClosed},
+			{op: "ok", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+		}},
+		{"open ignores late results and waits openFor", []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail"},
+			{op: "fail", want: BreakerOpen, event: true, blocks: true},
+			{op: "ok", want: BreakerOpen, blocks: true},
+			{op: "advance", at: 999 * time.Millisecond, want: BreakerOpen, blocks: true},
+			{op: "advance", at: time.Second, want: BreakerHalfOpen, event: true},
+		}},
+		{"half-open closes after halfOpenMax successes", []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "fail", want: BreakerOpen, event: true, blocks: true},
+			{op: "advance", at: time.Second, want: BreakerHalfOpen, event: true},
+			{op: "admit", want: BreakerHalfOpen},
+			{op: "admit", want: BreakerHalfOpen, blocks: true},
+			{op: "ok", want: BreakerHalfOpen, blocks: true},
+			{op: "ok", want: BreakerClosed, event: true},
+		}},
+		{"half-open reopens on a failed trial", []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "fail", want: BreakerOpen, event: true, blocks: true},
+			{op: "advance", at: time.Second, want: BreakerHalfOpen, event: true},
+			{op: "admit", want: BreakerHalfOpen},
+			{op: "fail", at: time.Second, want: BreakerOpen, event: true, blocks: true},
+			{op: "advance", at: 1999 * time.Millisecond, want: BreakerOpen, blocks: true},
+			{op: "advance", at: 2 * time.Second, want: BreakerHalfOpen, event: true},
+		}},
+		{"unadmit returns a trial slot", []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "fail", want: BreakerOpen, event: true, blocks: true},
+			{op: "advance", at: time.Second, want: BreakerHalfOpen, event: true},
+			{op: "admit", want: BreakerHalfOpen},
+			{op: "admit", want: BreakerHalfOpen, blocks: true},
+			{op: "unadmit", want: BreakerHalfOpen},
+		}},
+		{"closing starts a fresh window", []step{
+			{op: "fail"}, {op: "fail"}, {op: "fail"}, {op: "fail", want: BreakerOpen, event: true, blocks: true},
+			{op: "advance", at: time.Second, want: BreakerHalfOpen, event: true},
+			{op: "ok", want: BreakerHalfOpen},
+			{op: "ok", want: BreakerClosed, event: true},
+			{op: "fail", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+			{op: "fail", want: BreakerClosed},
+			{op: "fail", want: BreakerOpen, event: true, blocks: true},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := testBreaker()
+			for i, s := range tc.steps {
+				now := t0.Add(s.at)
+				var ev bool
+				switch s.op {
+				case "ok":
+					_, ev = b.record(false, now)
+				case "fail":
+					_, ev = b.record(true, now)
+				case "advance":
+					_, ev = b.advance(now)
+				case "admit":
+					b.admit()
+				case "unadmit":
+					b.unadmit()
+				}
+				if b.state != s.want || ev != s.event || b.blocked() != s.blocks {
+					t.Fatalf("step %d (%s): state=%s event=%v blocked=%v, want %s/%v/%v",
+						i, s.op, b.state, ev, b.blocked(), s.want, s.event, s.blocks)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerSlidingWindow(t *testing.T) {
+	b := newBreaker(breakerConfig{window: 4, minSamples: 4, failRate: 0.75, openFor: time.Second, halfOpenMax: 1})
+	now := time.Unix(0, 0)
+	// 2 falhas antigas saem da janela conforme sucessos entram
+	for _, failed := range []bool{true, true, false, false, false, false} {
+		if _, ev := b.record(failed, now); ev {
+			t.Fatalf("unexpected transition recording %v", failed)
+		}
+	}
+	if b.failRate() != 0 {
+		t.Fatalf("failRate = %v, want 0 after old failures slid out", b.failRate())
+	}
+	for i, failed := range []bool{true, true, true} {
+		ev, ok := b.record(failed, now)
+		if i < 2 && ok {
+			t.Fatalf("opened after %d failures, want 3", i+1)
+		}
+		if i == 2 && (!ok || ev.To != BreakerOpen || ev.FailRate != 0.75 || !ev.Until.Equal(now.Add(time.Second))) {
+			t.Fatalf("event = %+v, %v; want open at 0.75 until now+1s", ev, ok)
+		}
+	}
+}
+
+func TestBreakerForceOpen(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := testBreaker()
+
+	if _, ok := b.forceOpen(now.Add(-time.Second), now); ok || b.state != BreakerClosed {
+		t.Fatalf("expired remote open applied: state=%s", b.state)
+	}
+	ev, ok := b.forceOpen(now.Add(3*time.Second), now)
+	if !ok || b.state != BreakerOpen || !ev.Until.Equal(now.Add(3*time.Second)) {
+		t.Fatalf("forceOpen = %+v, %v; state=%s", ev, ok, b.state)
+	}
+	// estende sem nova transição; mais curto não encurta
+	if _, ok := b.forceOpen(now.Add(5*time.Second), now); ok || !b.openUntil.Equal(now.Add(5*time.Second)) {
+		t.Fatalf("extend: event=%v openUntil=%v", ok, b.openUntil)
+	}
+	if _, ok := b.forceOpen(now.Add(2*time.Second), now); ok || !b.openUntil.Equal(now.Add(5*time.Second)) {
+		t.Fatalf("shorter remote open changed openUntil to %v", b.openUntil)
+	}
+	if _, ok := b.advance(now.Add(5 * time.Second)); !ok || b.state != BreakerHalfOpen {
+		t.Fatalf("advance at openUntil: state=%s", b.state)
+	}
+}
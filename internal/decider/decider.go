@@ -1,109 +1,198 @@
 package decider
 
 import (
-	"math/rand/v2"
+	"log"
 	"sync"
 	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/shopspring/decimal"
 )
 
 type Provider string
 
-const (
-	ProviderDefault  Provider = "default"
-	ProviderFallback Provider = "fallback"
-)
-
 type state struct {
-	latEWMA     time.Duration
-	errs        int
-	total       int
-	cbOpenUntil time.Time
-	failing     bool
-	minRespMs   int
-	updatedAt   time.Time
+	latEWMA   time.Duration
+	okDecay   float64 // sucessos com decaimento (para estratégias probabilísticas)
+	errDecay  float64 // falhas com decaimento
+	cb        *breaker
+	failing   bool
+	minRespMs int
+	updatedAt time.Time
 }
 
 type Decider struct {
-	mu           sync.RWMutex
-	s            map[Provider]*state
-	marginMs     int
-	epsilon      float64
-	cbFailRate   float64
-	cbMinSamples int
-	cbTimeout    time.Duration
-}
-
-func New() *Decider {
-	return &Decider{
-		s: map[Provider]*state{
-			ProviderDefault:  {latEWMA: 50 * time.Millisecond},
-			ProviderFallback: {latEWMA: 60 * time.Millisecond},
-		},
-		marginMs:     150,
-		epsilon:      0.01,
-		cbFailRate:   0.25,
-		cbMinSamples: 40,
-		cbTimeout:    2 * time.Second,
-	}
+	mu       sync.Mutex
+	order    []Provider // por prioridade (índice 0 = preferido)
+	fees     map[Provider]processors.Spec
+	s        map[Provider]*state
+	strategy Strategy
+	cbCfg    breakerConfig
+	now      func() time.Time
+
+	transitions map[Provider]map[BreakerState]int64 // contagem de entradas em cada estado
+	onBreaker   []func(BreakerEvent)
 }
 
-func (d *Decider) Choose() string {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+// Options: ajustes opcionais do Decider; campos zerados mantêm os defaults.
+type Options struct {
+	Now     func() time.Time // relógio; o decidersim injeta tempo virtual
+	Breaker BreakerConfig
+}
 
-	if rand.Float64() < d.epsilon {
-		if rand.IntN(2) == 0 {
-			return string(ProviderDefault)
-		}
-		return string(ProviderFallback)
+// BreakerConfig: parâmetros do breaker de cada provider.
+type BreakerConfig struct {
+	Window      int           // default 100 chamadas
+	MinSamples  int           // default 40
+	FailRate    float64       // default 0.25
+	OpenFor     time.Duration // default 2s
+	HalfOpenMax int           // default 5
+}
+
+func New(reg *processors.Registry, strategy Strategy) *Decider {
+	return NewWithOptions(reg, strategy, Options{})
+}
+
+func NewWithOptions(reg *processors.Registry, strategy Strategy, opts Options) *Decider {
+	d := &Decider{
+		fees:     make(map[Provider]processors.Spec),
+		s:        make(map[Provider]*state),
+		strategy: strategy,
+		cbCfg: breakerConfig{
+			window:      orInt(opts.Breaker.Window, 100),
+			minSamples:  orInt(opts.Breaker.MinSamples, 40),
+			failRate:    opts.Breaker.FailRate,
+			openFor:     opts.Breaker.OpenFor,
+			halfOpenMax: orInt(opts.Breaker.HalfOpenMax, 5),
+		},
+		now:         opts.Now,
+		transitions: make(map[Provider]map[BreakerState]int64),
+	}
+	if d.cbCfg.failRate <= 0 {
+		d.cbCfg.failRate = 0.25
 	}
+	if d.cbCfg.openFor <= 0 {
+		d.cbCfg.openFor = 2 * time.Second
+	}
+	if d.now == nil {
+		d.now = time.Now
+	}
+	for i, spec := range reg.All() {
+		p := Provider(spec.Name)
+		d.order = append(d.order, p)
+		d.fees[p] = spec
+		// chute inicial: providers menos prioritários começam um pouco mais "lentos"
+		d.s[p] = d.newState(50*time.Millisecond + time.Duration(i)*10*time.Millisecond)
+	}
+	d.OnBreakerChange(func(ev BreakerEvent) {
+		origin := "local"
+		if ev.Remote {
+			origin = "remote"
+		}
+		log.Printf("breaker %s: %s -> %s (fail rate %.2f, %s)", ev.Provider, ev.From, ev.To, ev.FailRate, origin)
+	})
+	return d
+}
 
-	now := time.Now()
-	def := d.s[ProviderDefault]
-	fb := d.s[ProviderFallback]
+// OnBreakerChange registra um callback para transições de breaker.
+// Chamado fora do lock do Decider; deve ser registrado antes dos workers subirem.
+func (d *Decider) OnBreakerChange(fn func(BreakerEvent)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onBreaker = append(d.onBreaker, fn)
+}
 
-	defBlocked := def.cbOpenUntil.After(now) || def.failing
-	fbBlocked := fb.cbOpenUntil.After(now) || fb.failing
+// Choose delega a escolha à estratégia configurada.
+func (d *Decider) Choose(amount decimal.Decimal) string {
+	return d.ChooseExcept(amount, nil)
+}
 
-	if defBlocked && !fbBlocked {
-		return string(ProviderFallback)
+// ChooseExcept: como Choose, mas sem os providers em skip (ex.: sem vaga de
+// concorrência no dispatcher). Devolve "" se todos estiverem em skip.
+func (d *Decider) ChooseExcept(amount decimal.Decimal, skip map[Provider]bool) string {
+	now := d.now()
+	d.mu.Lock()
+	var events []BreakerEvent
+	for _, p := range d.order {
+		if ev, ok := d.s[p].cb.advance(now); ok {
+			events = append(events, d.eventLocked(p, ev))
+		}
 	}
-	if fbBlocked && !defBlocked {
-		return string(ProviderDefault)
+	snaps := d.snapshotLocked()
+	if len(skip) > 0 {
+		kept := snaps[:0]
+		for _, s := range snaps {
+			if !skip[s.Provider] {
+				kept = append(kept, s)
+			}
+		}
+		snaps = kept
 	}
-	if defBlocked && fbBlocked {
-		if def.latEWMA <= fb.latEWMA {
-			return string(ProviderDefault)
+	var choice Provider
+	if len(snaps) > 0 {
+		choice = d.strategy.Choose(amount.InexactFloat64(), snaps)
+		if st, ok := d.s[choice]; ok {
+			st.cb.admit()
 		}
-		return string(ProviderFallback)
 	}
+	d.mu.Unlock()
+
+	d.emit(events)
+	return string(choice)
+}
+
+// Abandon desfaz uma escolha que não virou chamada (sem Observe): devolve a
+// vaga de teste do half-open, senão o breaker fica preso bloqueado.
+func (d *Decider) Abandon(p Provider) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if st, ok := d.s[p]; ok {
+		st.cb.unadmit()
+	}
+}
 
-	margin := time.Duration(d.marginMs) * time.Millisecond
-	if def.latEWMA <= fb.latEWMA+margin {
-		return string(ProviderDefault)
+// snapshotLocked monta a visão por provider em ordem de prioridade. Exige d.mu.
+func (d *Decider) snapshotLocked() []Snapshot {
+	out := make([]Snapshot, len(d.order))
+	for i, p := range d.order {
+		st := d.s[p]
+		out[i] = Snapshot{
+			Provider:  p,
+			Fee:       d.fees[p].Fee,
+			FeeFixed:  d.fees[p].FeeFixed,
+			LatEWMA:   st.latEWMA,
+			Breaker:   st.cb.state,
+			Blocked:   st.cb.blocked() || st.failing,
+			Successes: st.okDecay,
+			Failures:  st.errDecay,
+			MinRespMs: st.minRespMs,
+		}
 	}
-	return string(ProviderFallback)
+	return out
 }
 
 func (d *Decider) Observe(p Provider, dur time.Duration, err error) {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	st := d.ensureState(p)
-	st.total++
-	if err != nil {
-		st.errs++
-	}
 	const alpha = 0.3
 	st.latEWMA = time.Duration(alpha*float64(dur) + (1-alpha)*float64(st.latEWMA))
 
-	if st.total >= d.cbMinSamples {
-		rate := float64(st.errs) / float64(st.total)
-		if rate >= d.cbFailRate {
-			st.cbOpenUntil = time.Now().Add(d.cbTimeout)
-			st.errs = 0
-			st.total = 0
-		}
+	const gamma = 0.99 // esquece o passado aos poucos para acompanhar mudanças
+	st.okDecay *= gamma
+	st.errDecay *= gamma
+	if err != nil {
+		st.errDecay++
+	} else {
+		st.okDecay++
 	}
+
+	var events []BreakerEvent
+	if ev, ok := st.cb.record(err != nil, d.now()); ok {
+		events = append(events, d.eventLocked(p, ev))
+	}
+	d.mu.Unlock()
+
+	d.emit(events)
 }
 
 func (d *Decider) UpdateHealth(p Provider, failing bool, minRespMs int) {
@@ -112,14 +201,83 @@ func (d *Decider) UpdateHealth(p Provider, failing bool, minRespMs int) {
 	st := d.ensureState(p)
 	st.failing = failing
 	st.minRespMs = minRespMs
-	st.updatedAt = time.Now()
+	st.updatedAt = d.now()
+}
+
+// ApplyRemoteBreaker abre o breaker local de p até until, propagando a decisão
+// de outra instância. O evento gerado sai com Remote=true.
+func (d *Decider) ApplyRemoteBreaker(p Provider, until time.Time) {
+	d.mu.Lock()
+	var events []BreakerEvent
+	if ev, ok := d.ensureState(p).cb.forceOpen(until, d.now()); ok {
+		ev.Remote = true
+		events = append(events, d.eventLocked(p, ev))
+	}
+	d.mu.Unlock()
+
+	d.emit(events)
+}
+
+// BreakerStats devolve o estado atual e a contagem de transições por provider.
+type BreakerStats struct {
+	State       BreakerState
+	Transitions map[BreakerState]int64
+}
+
+func (d *Decider) BreakerStats() map[Provider]BreakerStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[Provider]BreakerStats, len(d.s))
+	for p, st := range d.s {
+		tr := make(map[BreakerState]int64, len(d.transitions[p]))
+		for k, v := range d.transitions[p] {
+			tr[k] = v
+		}
+		out[p] = BreakerStats{State: st.cb.state, Transitions: tr}
+	}
+	return out
+}
+
+// eventLocked completa o evento e atualiza os contadores. Exige d.mu.
+func (d *Decider) eventLocked(p Provider, ev BreakerEvent) BreakerEvent {
+	ev.Provider = p
+	if d.transitions[p] == nil {
+		d.transitions[p] = make(map[BreakerState]int64)
+	}
+	d.transitions[p][ev.To]++
+	return ev
+}
+
+func (d *Decider) emit(events []BreakerEvent) {
+	if len(events) == 0 {
+		return
+	}
+	d.mu.Lock()
+	fns := d.onBreaker
+	d.mu.Unlock()
+	for _, ev := range events {
+		for _, fn := range fns {
+			fn(ev)
+		}
+	}
+}
+
+func (d *Decider) newState(lat time.Duration) *state {
+	return &state{latEWMA: lat, cb: newBreaker(d.cbCfg)}
 }
 
 func (d *Decider) ensureState(p Provider) *state {
 	if st, ok := d.s[p]; ok {
 		return st
 	}
-	st := &state{latEWMA: 80 * time.Millisecond}
+	st := d.newState(80 * time.Millisecond)
 	d.s[p] = st
 	return st
-}
\ No newline at end of file
+}
+
+func orInt(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
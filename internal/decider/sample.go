@@ -0,0 +1,38 @@
+package decider
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// betaSample sorteia de Beta(a, b) via duas Gammas.
+func betaSample(r *rand.Rand, a, b float64) float64 {
+	x := gammaSample(r, a)
+	y := gammaSample(r, b)
+	if x+y == 0 {
+		return 0.5
+	}
+	return x / (x + y)
+}
+
+// gammaSample: Marsaglia-Tsang para Gamma(shape, 1).
+func gammaSample(r *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// boost: Gamma(a) = Gamma(a+1) * U^(1/a)
+		return gammaSample(r, shape+1) * math.Pow(r.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package decider
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Snapshot: visão somente-leitura de um provider no momento da escolha.
+type Snapshot struct {
+	Provider  Provider
+	Fee       float64
+	FeeFixed  float64
+	LatEWMA   time.Duration
+	Breaker   BreakerState
+	Blocked   bool    // breaker aberto (ou half-open sem vagas de teste) ou health check reportando falha
+	Successes float64 // contagens com decaimento vindas de Observe
+	Failures  float64
+	MinRespMs int
+}
+
+// Strategy decide para qual provider mandar o próximo pagamento de valor amount.
+// ps vem sempre não-vazio e em ordem de prioridade. Implementações com
+// estado próprio precisam ser seguras para uso concorrente.
+type Strategy interface {
+	Choose(amount float64, ps []Snapshot) Provider
+}
+
+// NewStrategy monta a estratégia pelo nome usado na config (ROUTING_STRATEGY).
+func NewStrategy(name string) (Strategy, error) {
+	return NewStrategyWithRand(name, nil)
+}
+
+// NewStrategyWithRand: como NewStrategy, mas os sorteios das estratégias aleatórias
+// (ewma, thompson) saem de rng — reprodutível no decidersim. nil = semente aleatória.
+func NewStrategyWithRand(name string, rng *rand.Rand) (Strategy, error) {
+	switch name {
+	case "", "ewma":
+		return NewEWMAStrategyWithRand(150*time.Millisecond, 0.01, rng), nil
+	case "cost":
+		return CostStrategy{}, nil
+	case "wrr":
+		return NewWeightedRoundRobin(), nil
+	case "thompson":
+		return NewThompsonWithRand(rng), nil
+	case "revenue":
+		return RevenueStrategy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy: %q", name)
+	}
+}
+
+// available devolve os providers não bloqueados; se todos estiverem, devolve todos.
+func available(ps []Snapshot) []Snapshot {
+	out := make([]Snapshot, 0, len(ps))
+	for _, s := range ps {
+		if !s.Blocked {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return ps
+	}
+	return out
+}
+
+// fastest: menor EWMA; empate fica com o de maior prioridade.
+func fastest(ps []Snapshot) Snapshot {
+	best := ps[0]
+	for _, s := range ps[1:] {
+		if s.LatEWMA < best.LatEWMA {
+			best = s
+		}
+	}
+	return best
+}
+
+// EWMAStrategy: política original — exploração epsilon, bloqueio por breaker/health
+// e preferência pelo provider prioritário enquanto a latência estiver dentro da margem.
+type EWMAStrategy struct {
+	margin  time.Duration
+	epsilon float64
+
+	mu  sync.Mutex
+	rng *rand.Rand // nil = math/rand global
+}
+
+func NewEWMAStrategy(margin time.Duration, epsilon float64) *EWMAStrategy {
+	return NewEWMAStrategyWithRand(margin, epsilon, nil)
+}
+
+// NewEWMAStrategyWithRand: a exploração epsilon sorteia com rng (nil = global).
+func NewEWMAStrategyWithRand(margin time.Duration, epsilon float64, rng *rand.Rand) *EWMAStrategy {
+	return &EWMAStrategy{margin: margin, epsilon: epsilon, rng: rng}
+}
+
+// explore sorteia a exploração epsilon: índice do provider aleatório, ou -1.
+func (s *EWMAStrategy) explore(n int) int {
+	if s.rng == nil {
+		if rand.Float64() < s.epsilon {
+			return rand.IntN(n)
+		}
+		return -1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rng.Float64() < s.epsilon {
+		return s.rng.IntN(n)
+	}
+	return -1
+}
+
+func (s *EWMAStrategy) Choose(amount float64, ps []Snapshot) Provider {
+	open := make([]Snapshot, 0, len(ps))
+	for _, p := range ps {
+		if !p.Blocked {
+			open = append(open, p)
+		}
+	}
+	// todos bloqueados: vai no mais rápido
+	if len(open) == 0 {
+		return fastest(ps).Provider
+	}
+
+	// explora só entre os liberados: breaker aberto/health failing não é candidato
+	if i := s.explore(len(open)); i >= 0 {
+		return open[i].Provider
+	}
+
+	// preferido (maior prioridade disponível) vence, a menos que outro seja mais rápido além da margem
+	primary := open[0]
+	best := fastest(open)
+	if primary.LatEWMA <= best.LatEWMA+s.margin {
+		return primary.Provider
+	}
+	return best.Provider
+}
+
+// CostStrategy: sempre o provider disponível de menor fee; empate pela latência.
+type CostStrategy struct{}
+
+func (CostStrategy) Choose(amount float64, ps []Snapshot) Provider {
+	cand := available(ps)
+	best := cand[0]
+	for _, s := range cand[1:] {
+		sf, bf := s.feeFor(amount), best.feeFor(amount)
+		if sf < bf || (sf == bf && s.LatEWMA < best.LatEWMA) {
+			best = s
+		}
+	}
+	return best.Provider
+}
+
+// RevenueStrategy maximiza a receita líquida esperada: P(sucesso) × (amount - fee).
+// P(sucesso) é a média a posteriori de Beta(1+sucessos, 1+falhas).
+type RevenueStrategy struct{}
+
+func (RevenueStrategy) Choose(amount float64, ps []Snapshot) Provider {
+	cand := available(ps)
+	best := cand[0].Provider
+	bestScore := math.Inf(-1)
+	for _, s := range cand {
+		score := s.successRate() * (amount - s.feeFor(amount))
+		if score > bestScore {
+			best, bestScore = s.Provider, score
+		}
+	}
+	return best
+}
+
+func (s Snapshot) feeFor(amount float64) float64 { return amount*s.Fee + s.FeeFixed }
+
+func (s Snapshot) successRate() float64 {
+	return (1 + s.Successes) / (2 + s.Successes + s.Failures)
+}
+
+// WeightedRoundRobin: smooth weighted round-robin (algoritmo do nginx) com peso
+// inversamente proporcional à latência observada.
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[Provider]int
+}
+
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{current: make(map[Provider]int)}
+}
+
+func (w *WeightedRoundRobin) Choose(amount float64, ps []Snapshot) Provider {
+	cand := available(ps)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	total := 0
+	var best Provider
+	bestCur := 0
+	for i, s := range cand {
+		weight := wrrWeight(s.LatEWMA)
+		total += weight
+		w.current[s.Provider] += weight
+		if cur := w.current[s.Provider]; i == 0 || cur > bestCur {
+			best, bestCur = s.Provider, cur
+		}
+	}
+	w.current[best] -= total
+	return best
+}
+
+func wrrWeight(lat time.Duration) int {
+	ms := lat.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	weight := int(1000 / ms)
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
+
+// Thompson: amostragem de Thompson sobre Beta(1+sucessos, 1+falhas), ponderada
+// pelo valor que sobra após o fee.
+type Thompson struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewThompson() *Thompson {
+	return NewThompsonWithRand(nil)
+}
+
+// NewThompsonWithRand: amostras Beta saem de rng (nil = semente aleatória).
+func NewThompsonWithRand(rng *rand.Rand) *Thompson {
+	if rng == nil {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return &Thompson{rng: rng}
+}
+
+func (t *Thompson) Choose(amount float64, ps []Snapshot) Provider {
+	cand := available(ps)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	best := cand[0].Provider
+	bestScore := -1.0
+	for _, s := range cand {
+		score := betaSample(t.rng, 1+s.Successes, 1+s.Failures) * (amount - s.feeFor(amount))
+		if score > bestScore {
+			best, bestScore = s.Provider, score
+		}
+	}
+	return best
+}
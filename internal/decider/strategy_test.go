@@ -0,0 +1,30 @@
+package decider
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestEWMAExploresOnlyOpenProviders(t *testing.T) {
+	// epsilon 1: toda escolha é exploração
+	s := NewEWMAStrategyWithRand(150*time.Millisecond, 1, rand.New(rand.NewPCG(1, 2)))
+	ps := []Snapshot{
+		{Provider: "default", Blocked: true, LatEWMA: 10 * time.Millisecond},
+		{Provider: "fallback", LatEWMA: 50 * time.Millisecond},
+		{Provider: "third", Blocked: true, LatEWMA: 20 * time.Millisecond},
+	}
+	for i := 0; i < 200; i++ {
+		if got := s.Choose(100, ps); got != "fallback" {
+			t.Fatalf("choice %d = %s, want fallback (only open provider)", i, got)
+		}
+	}
+
+	// todos bloqueados: o mais rápido, sem sorteio
+	ps[1].Blocked = true
+	for i := 0; i < 50; i++ {
+		if got := s.Choose(100, ps); got != "default" {
+			t.Fatalf("all blocked: choice %d = %s, want default", i, got)
+		}
+	}
+}
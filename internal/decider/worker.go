@@ -9,37 +9,93 @@ import (
 	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
 )
 
-const lockKey int64 = 987654321
+const (
+	lockKey int64 = 987654321
+
+	healthEvery = 5 * time.Second        // limite do /service-health nos processors
+	syncEvery   = 500 * time.Millisecond // leitura do estado compartilhado
+	healthStale = 3 * healthEvery        // ignora health de um dono que sumiu
+)
+
+// StartHealthWorker: quem pega o advisory lock consulta os processors e grava o
+// health em provider_state; todas as instâncias leem a tabela a cada syncEvery.
+// Aberturas de breaker locais também são publicadas para as demais instâncias.
+func StartHealthWorker(ctx context.Context, db repo.DB, proc *processors.Client, d *Decider, instanceID string) {
+	opened := make(chan BreakerEvent, 64)
+	d.OnBreakerChange(func(ev BreakerEvent) {
+		if ev.Remote || ev.To != BreakerOpen {
+			return
+		}
+		select {
+		case opened <- ev:
+		default: // não trava o caminho do dispatcher
+		}
+	})
 
-func StartHealthWorker(ctx context.Context, db repo.DB, proc *processors.Client, d *Decider) {
 	go func() {
-		t := time.NewTicker(5 * time.Second)
-		defer t.Stop()
+		ht := time.NewTicker(healthEvery)
+		defer ht.Stop()
+		st := time.NewTicker(syncEvery)
+		defer st.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-t.C:
-				ok, err := db.TryGlobalLock(ctx, lockKey)
-				if err != nil {
-					log.Printf("health lock err: %v", err)
-					continue
-				}
-				if !ok {
-					continue
+			case ev := <-opened:
+				ctx2, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+				if err := db.SaveBreaker(ctx2, repo.Provider(ev.Provider), ev.To.String(), ev.Until, instanceID); err != nil {
+					log.Printf("breaker publish err: %v", err)
 				}
-				func() {
-					defer db.UnlockGlobal(ctx, lockKey)
-					ctx2, cancel := context.WithTimeout(ctx, 800*time.Millisecond)
-					defer cancel()
-					if hi, err := proc.Health(ctx2, processors.ProviderDefault); err == nil {
-						d.UpdateHealth(ProviderDefault, hi.Failing, hi.MinResponseMs)
-					}
-					if hi, err := proc.Health(ctx2, processors.ProviderFallback); err == nil {
-						d.UpdateHealth(ProviderFallback, hi.Failing, hi.MinResponseMs)
-					}
-				}()
+				cancel()
+			case <-ht.C:
+				pollHealth(ctx, db, proc, d)
+			case <-st.C:
+				syncShared(ctx, db, d, instanceID)
 			}
 		}
 	}()
 }
+
+func pollHealth(ctx context.Context, db repo.DB, proc *processors.Client, d *Decider) {
+	ok, err := db.TryGlobalLock(ctx, lockKey)
+	if err != nil {
+		log.Printf("health lock err: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer db.UnlockGlobal(ctx, lockKey)
+	ctx2, cancel := context.WithTimeout(ctx, 800*time.Millisecond)
+	defer cancel()
+	for _, p := range proc.Registry().Names() {
+		hi, err := proc.Health(ctx2, p)
+		if err != nil {
+			continue
+		}
+		d.UpdateHealth(Provider(p), hi.Failing, hi.MinResponseMs)
+		if err := db.SaveHealth(ctx2, repo.Provider(p), hi.Failing, hi.MinResponseMs); err != nil {
+			log.Printf("health save err: %v", err)
+		}
+	}
+}
+
+func syncShared(ctx context.Context, db repo.DB, d *Decider, instanceID string) {
+	ctx2, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	states, err := db.LoadProviderStates(ctx2)
+	if err != nil {
+		log.Printf("provider state load err: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, s := range states {
+		p := Provider(s.Provider)
+		if s.HealthAt != nil && now.Sub(*s.HealthAt) < healthStale {
+			d.UpdateHealth(p, s.Failing, s.MinResponseMs)
+		}
+		if s.BreakerBy != instanceID && s.BreakerUntil != nil && s.BreakerUntil.After(now) {
+			d.ApplyRemoteBreaker(p, *s.BreakerUntil)
+		}
+	}
+}
@@ -2,94 +2,363 @@ package dispatcher
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/josinaldojr/rinha-backend-2025/internal/decider"
+	"github.com/josinaldojr/rinha-backend-2025/internal/metrics"
 	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
 	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 const (
-	dispatchLoopEvery = 20 * time.Millisecond // controla a pressão no DB
-	dispatchBatchSize = 64                    // lotes menores = menos picos de UPDATE
+	safetyPollEvery   = 250 * time.Millisecond // rede de segurança caso um NOTIFY se perca
+	dispatchBatchSize = 64                     // lotes menores = menos picos de UPDATE
 
 	delayedConfirmAfter = 150 * time.Millisecond // segunda confirmação logo depois do timeout
 	confirmHTTPTimeout  = 400 * time.Millisecond // timeout do GET /payments/{id}
+
+	itemTimeout  = 2 * time.Second        // teto por item (Pay + confirmações + Finish), inclusive no shutdown
+	maxSlotWait  = 500 * time.Millisecond // espera máxima por vaga de provider antes de devolver à fila
+	writeTimeout = time.Second            // cada Finish/Retry/Release/MarkFailed, independente do orçamento do item
 )
 
-func Start(ctx context.Context, db repo.DB, proc *processors.Client, d *decider.Decider) {
+// Options controla a concorrência do dispatcher.
+type Options struct {
+	Workers     int                         // itens despachados em paralelo
+	PerProvider map[processors.Provider]int // limite de chamadas simultâneas por provider (ausente = só o global)
+	Retry       retry.Policy
+	Owner       string        // dono do lease (INSTANCE_ID)
+	Lease       time.Duration // validade do claim; precisa ser > itemTimeout
+}
+
+type dispatcher struct {
+	db    repo.DB
+	proc  *processors.Client
+	d     *decider.Decider
+	limit map[processors.Provider]chan struct{}
+	retry retry.Policy
+	owner string // lease_owner dos claims; Finish/Retry/MarkFailed só valem com ele
+
+	freedMu sync.Mutex
+	freed   chan struct{} // fechado (e trocado) a cada vaga de provider liberada
+}
+
+// Start sobe o loop de claim e o pool de workers. O canal devolvido fecha quando,
+// após o cancelamento de ctx, todos os itens já em andamento foram finalizados.
+func Start(ctx context.Context, db repo.DB, proc *processors.Client, d *decider.Decider, opts Options) <-chan struct{} {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	lease := max(opts.Lease, 2*itemTimeout)
+	ds := &dispatcher{db: db, proc: proc, d: d, limit: make(map[processors.Provider]chan struct{}), retry: opts.Retry, owner: opts.Owner, freed: make(chan struct{})}
+	for p, n := range opts.PerProvider {
+		if n > 0 {
+			ds.limit[p] = make(chan struct{}, n)
+		}
+	}
+	// todos os providers limitados: não reivindica mais do que cabe nas vagas somadas,
+	// senão o excedente só esperaria vaga e voltaria para a fila
+	if slots, bounded := ds.slotCapacity(); bounded {
+		workers = max(1, min(workers, slots))
+	}
+
+	jobs := make(chan repo.BatchItem)
+	freed := make(chan struct{}, 1)
+	var busy atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				ds.dispatchOne(ctx, it)
+				busy.Add(-1)
+				select {
+				case freed <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
 	go func() {
-		t := time.NewTicker(dispatchLoopEvery)
+		defer close(done)
+		defer wg.Wait()
+		defer close(jobs)
+
+		wake := db.Notifications(ctx)
+		t := time.NewTicker(safetyPollEvery)
 		defer t.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-wake:
 			case <-t.C:
-				items, err := db.ClaimPendingBatch(ctx, dispatchBatchSize)
+			case <-freed:
+			}
+			// esvazia a fila até onde há worker livre: só faz claim do que vai despachar já,
+			// então nada fica DISPATCHING esperando na memória
+			for ctx.Err() == nil {
+				free := workers - int(busy.Load())
+				if free <= 0 {
+					break // um worker livre acorda o loop via freed
+				}
+				items, err := db.ClaimPendingBatch(ctx, opts.Owner, lease, min(free, dispatchBatchSize))
 				if err != nil || len(items) == 0 {
-					continue
+					break
 				}
+				metrics.DispatchBatch(len(items))
 				for _, it := range items {
-					sentAt := time.Now().UTC()
-					prov := processors.Provider(d.Choose())
-
-					start := time.Now()
-					err := proc.Pay(ctx, prov, it.CorrelationID, it.Amount, sentAt)
-					d.Observe(decider.Provider(prov), time.Since(start), err)
-
-					if err == nil {
-						// caminho feliz: fecha imediato
-						_ = db.Finish(ctx, it.CorrelationID, repo.Provider(prov), repo.StatusProcessed, sentAt)
-						continue
-					}
-
-					// 1) confirmação imediata
-					if quickConfirm(ctx, proc, prov, it.CorrelationID) {
-						_ = db.Finish(ctx, it.CorrelationID, repo.Provider(prov), repo.StatusProcessed, sentAt)
-						continue
-					}
-
-					// 2) confirmação "um instante depois"
-					delayedCtx, cancel := context.WithTimeout(ctx, confirmHTTPTimeout+50*time.Millisecond)
-					timer := time.NewTimer(delayedConfirmAfter)
-					select {
-					case <-delayedCtx.Done():
-						timer.Stop()
-					case <-timer.C:
-						if quickConfirm(delayedCtx, proc, prov, it.CorrelationID) {
-							cancel()
-							_ = db.Finish(ctx, it.CorrelationID, repo.Provider(prov), repo.StatusProcessed, sentAt)
-							continue
-						}
-						cancel()
-					}
-
-					// ainda não achou? mantém PENDING para o reconciler decidir
-					_ = db.Finish(ctx, it.CorrelationID, repo.Provider(prov), repo.StatusPending, sentAt)
+					busy.Add(1)
+					jobs <- it
+				}
+				if len(items) < min(free, dispatchBatchSize) {
+					break
 				}
 			}
 		}
 	}()
+	return done
+}
+
+func (ds *dispatcher) dispatchOne(parent context.Context, it repo.BatchItem) {
+	// item já reivindicado termina mesmo com shutdown em curso (senão fica DISPATCHING)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), itemTimeout)
+	defer cancel()
+	proc, d := ds.proc, ds.d
+
+	// continua o trace do intake gravado na linha
+	ctx, sp := tracing.Start(tracing.FromTraceParent(ctx, it.TraceParent), "payment.dispatch",
+		attribute.String("payment.correlation_id", it.CorrelationID.String()),
+		attribute.Int("payment.attempt", it.Attempts),
+		attribute.Bool("payment.abandoned", it.Abandoned),
+	)
+	defer sp.End()
+
+	// retry/requeue: a tentativa anterior pode ter sido aceita pelo provider mesmo com
+	// erro/timeout; confirma lá antes de pagar de novo (evita cobrança em dobro)
+	if it.Provider != repo.ProviderUnassigned {
+		prev := processors.Provider(it.Provider)
+		if at, ok := quickConfirm(ctx, proc, prev, it.CorrelationID); ok {
+			ds.finish(ctx, it, it.Provider, orElse(at, it.RequestedAt))
+			return
+		}
+	}
+	// lease expirado: a instância que caiu pode ter pago em qualquer provider sem gravar.
+	// it.RequestedAt aqui é o do intake/claim, não o do POST perdido: vale o do processor
+	if it.Abandoned {
+		for _, p := range proc.Registry().Names() {
+			if p == processors.Provider(it.Provider) {
+				continue
+			}
+			if at, ok := quickConfirm(ctx, proc, p, it.CorrelationID); ok {
+				ds.finish(ctx, it, repo.Provider(p), orElse(at, it.RequestedAt))
+				return
+			}
+		}
+	}
+
+	prov, release, err := ds.route(ctx, parent, it.Amount)
+	if err != nil {
+		// sem vaga a tempo (ou desligando): devolve para a fila sem gastar tentativa nem
+		// sobrescrever last_error — o item nem chegou a um processor
+		sp.SetAttributes(attribute.String("payment.outcome", "released"))
+		ds.write(ctx, it.CorrelationID, "release", func(wctx context.Context) error {
+			return ds.db.Release(wctx, it.CorrelationID, ds.owner)
+		})
+		return
+	}
+	defer release()
+	metrics.DeciderChoice(string(prov))
+	sp.SetAttributes(attribute.String("processor.provider", string(prov)))
+
+	sentAt := time.Now().UTC()
+	start := time.Now()
+	err = proc.Pay(ctx, prov, it.CorrelationID, it.Amount, sentAt)
+	if err == nil || ctx.Err() == nil {
+		// estouro do orçamento do item não é culpa do provider
+		d.Observe(decider.Provider(prov), time.Since(start), err)
+	} else {
+		d.Abandon(decider.Provider(prov))
+	}
+
+	if err == nil {
+		// caminho feliz: fecha imediato
+		ds.finish(ctx, it, repo.Provider(prov), sentAt)
+		return
+	}
+
+	// 1) confirmação imediata
+	if _, ok := quickConfirm(ctx, proc, prov, it.CorrelationID); ok {
+		ds.finish(ctx, it, repo.Provider(prov), sentAt)
+		return
+	}
+
+	// 2) confirmação "um instante depois"
+	if _, ok := delayedConfirm(ctx, proc, prov, it.CorrelationID); ok {
+		ds.finish(ctx, it, repo.Provider(prov), sentAt)
+		return
+	}
+
+	// ainda não achou: agenda nova tentativa ou desiste
+	sp.RecordError(err)
+	if ds.retry.Exhausted(it.Attempts) {
+		sp.SetStatus(codes.Error, "retries exhausted")
+		ds.write(ctx, it.CorrelationID, "mark failed", func(wctx context.Context) error {
+			return ds.db.MarkFailed(wctx, it.CorrelationID, ds.owner, repo.Provider(prov), sentAt, err.Error())
+		})
+		return
+	}
+	next := time.Now().Add(ds.retry.Backoff(it.Attempts))
+	ds.write(ctx, it.CorrelationID, "retry", func(wctx context.Context) error {
+		return ds.db.Retry(wctx, it.CorrelationID, ds.owner, repo.Provider(prov), sentAt, next, err.Error())
+	})
+}
+
+func (ds *dispatcher) finish(ctx context.Context, it repo.BatchItem, prov repo.Provider, sentAt time.Time) {
+	ds.write(ctx, it.CorrelationID, "finish", func(wctx context.Context) error {
+		return ds.db.Finish(wctx, it.CorrelationID, ds.owner, prov, repo.StatusProcessed, sentAt)
+	})
+}
+
+// write grava o desfecho com contexto próprio: o do item pode já ter vencido em
+// Pay/confirmações, e a linha não pode ficar DISPATCHING até o lease expirar.
+func (ds *dispatcher) write(ctx context.Context, id uuid.UUID, op string, fn func(context.Context) error) {
+	wctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), writeTimeout)
+	defer cancel()
+	if err := fn(wctx); err != nil {
+		log.Printf("dispatch %s %s: %v", op, id, err)
+	}
+}
+
+// route escolhe o provider já reservando a vaga de concorrência dele: provider
+// lotado sai da escolha e o Decider decide entre os restantes. Com todos lotados,
+// espera a próxima vaga liberada, no máximo maxSlotWait (sobra orçamento para o Pay).
+func (ds *dispatcher) route(ctx, parent context.Context, amount decimal.Decimal) (processors.Provider, func(), error) {
+	wait := time.NewTimer(maxSlotWait)
+	defer wait.Stop()
+	for {
+		freed := ds.slotFreed() // antes de tentar: não perde liberação no meio
+		full := map[decider.Provider]bool{}
+		for {
+			p := ds.d.ChooseExcept(amount, full)
+			if p == "" {
+				break
+			}
+			prov := processors.Provider(p)
+			sem, ok := ds.limit[prov]
+			if !ok {
+				return prov, func() {}, nil
+			}
+			select {
+			case sem <- struct{}{}:
+				return prov, func() { <-sem; ds.signalFreed() }, nil
+			default:
+				ds.d.Abandon(decider.Provider(p))
+				full[decider.Provider(p)] = true
+			}
+		}
+		select {
+		case <-freed:
+		case <-wait.C:
+			return "", nil, errors.New("all providers at concurrency limit")
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-parent.Done():
+			return "", nil, errors.New("shutdown before dispatch")
+		}
+	}
+}
+
+// slotCapacity soma as vagas dos providers do registry; bounded=false se algum não tem limite.
+func (ds *dispatcher) slotCapacity() (int, bool) {
+	total := 0
+	for _, p := range ds.proc.Registry().Names() {
+		sem, ok := ds.limit[p]
+		if !ok {
+			return 0, false
+		}
+		total += cap(sem)
+	}
+	return total, true
+}
+
+// slotFreed devolve um canal fechado na próxima liberação de vaga de provider.
+func (ds *dispatcher) slotFreed() <-chan struct{} {
+	ds.freedMu.Lock()
+	defer ds.freedMu.Unlock()
+	return ds.freed
+}
+
+func (ds *dispatcher) signalFreed() {
+	ds.freedMu.Lock()
+	close(ds.freed)
+	ds.freed = make(chan struct{})
+	ds.freedMu.Unlock()
+}
+
+func delayedConfirm(ctx context.Context, proc *processors.Client, prov processors.Provider, id uuid.UUID) (time.Time, bool) {
+	delayedCtx, cancel := context.WithTimeout(ctx, confirmHTTPTimeout+50*time.Millisecond)
+	defer cancel()
+	timer := time.NewTimer(delayedConfirmAfter)
+	defer timer.Stop()
+	select {
+	case <-delayedCtx.Done():
+		return time.Time{}, false
+	case <-timer.C:
+		return quickConfirm(delayedCtx, proc, prov, id)
+	}
 }
 
 // quickConfirm faz uma verificação única no provider logo após erro/timeout do Pay.
-// Se o provider já tiver persistido a transação, retornamos true e marcamos PROCESSED.
-func quickConfirm(ctx context.Context, proc *processors.Client, prov processors.Provider, id uuid.UUID) bool {
+// Se o provider já tiver persistido a transação, retornamos true e marcamos PROCESSED,
+// com o requestedAt que o provider gravou (zero se a resposta não trouxer).
+func quickConfirm(ctx context.Context, proc *processors.Client, prov processors.Provider, id uuid.UUID) (time.Time, bool) {
 	httpc := &http.Client{Timeout: confirmHTTPTimeout}
-	base := proc.DefaultBase()
-	if prov == processors.ProviderFallback {
-		base = proc.FallbackBase()
+	base := proc.Base(prov)
+	if base == "" {
+		return time.Time{}, false
 	}
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/payments/%s", base, id.String()), nil)
+	req, sp := tracing.StartClient(req, "processor.confirm", attribute.String("processor.provider", string(prov)))
 	resp, err := httpc.Do(req)
 	if err != nil {
-		return false
+		tracing.End(sp, err)
+		return time.Time{}, false
 	}
 	defer resp.Body.Close()
-	return resp.StatusCode == 200
+	sp.SetAttributes(attribute.Bool("payment.found", resp.StatusCode == 200))
+	sp.End()
+	if resp.StatusCode != 200 {
+		return time.Time{}, false
+	}
+	var body struct {
+		RequestedAt time.Time `json:"requestedAt"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	return body.RequestedAt.UTC(), true
+}
+
+func orElse(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
 }
@@ -0,0 +1,197 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/decider"
+	"github.com/josinaldojr/rinha-backend-2025/internal/handlers"
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
+	"github.com/shopspring/decimal"
+)
+
+// stubProcessor imita POST /payments e GET /payments/{id} de um processor.
+// status != 200 faz o POST falhar; com keep, o pagamento fica gravado mesmo assim
+// (o provider aceitou, mas a resposta se perdeu).
+type stubProcessor struct {
+	mu     sync.Mutex
+	status int
+	keep   bool
+	posts  int
+	seen   map[uuid.UUID]time.Time // correlationId -> requestedAt recebido
+}
+
+func newStubProcessor(t *testing.T, status int, keep bool) (*stubProcessor, *httptest.Server) {
+	p := &stubProcessor{status: status, keep: keep, seen: map[uuid.UUID]time.Time{}}
+	srv := httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func (p *stubProcessor) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/payments":
+		var in struct {
+			CorrelationID uuid.UUID `json:"correlationId"`
+			RequestedAt   time.Time `json:"requestedAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		p.posts++
+		if p.status == http.StatusOK || p.keep {
+			p.seen[in.CorrelationID] = in.RequestedAt
+		}
+		w.WriteHeader(p.status)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/payments/"):
+		id, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/payments/"))
+		at, ok := p.seen[id]
+		if err != nil || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"correlationId": id, "requestedAt": at})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *stubProcessor) snapshot() (int, map[uuid.UUID]time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	seen := make(map[uuid.UUID]time.Time, len(p.seen))
+	for k, v := range p.seen {
+		seen[k] = v
+	}
+	return p.posts, seen
+}
+
+// pipeline: intake pelo handler, dispatcher rodando sobre MemDB contra o stub.
+type pipeline struct {
+	db *repo.MemDB
+	h  *handlers.Handler
+}
+
+func startPipeline(t *testing.T, base string, policy retry.Policy) *pipeline {
+	t.Helper()
+	reg, err := processors.NewRegistry([]processors.Spec{{Name: "default", BaseURL: base, Fee: 0.05}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategy, err := decider.NewStrategy("ewma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := repo.NewMemDB()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := Start(ctx, db, processors.NewClient(reg), decider.New(reg, strategy), Options{
+		Workers: 4,
+		Retry:   policy,
+		Owner:   "test",
+	})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return &pipeline{db: db, h: handlers.New(db, reg)}
+}
+
+func (p *pipeline) create(t *testing.T, id uuid.UUID, amount string) {
+	t.Helper()
+	body := `{"correlationId":"` + id.String() + `","amount":` + amount + `}`
+	rec := httptest.NewRecorder()
+	p.h.CreatePayment(rec, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("CreatePayment status = %d, want 202", rec.Code)
+	}
+}
+
+// await espera a linha sair de PENDING/DISPATCHING.
+func (p *pipeline) await(t *testing.T, id uuid.UUID) repo.Payment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pm, err := p.db.GetPayment(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pm.Status == repo.StatusProcessed || pm.Status == repo.StatusFailed {
+			return pm
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("payment %s still in flight", id)
+	return repo.Payment{}
+}
+
+func TestPipelineProcessesPayment(t *testing.T) {
+	stub, srv := newStubProcessor(t, http.StatusOK, false)
+	p := startPipeline(t, srv.URL, retry.Policy{MaxAttempts: 3, BaseBackoff: time.Millisecond})
+
+	id := uuid.New()
+	p.create(t, id, "19.90")
+	pm := p.await(t, id)
+
+	posts, seen := stub.snapshot()
+	if pm.Status != repo.StatusProcessed || pm.Provider != "default" || pm.Attempts != 1 {
+		t.Fatalf("payment = %+v, want PROCESSED on default after 1 attempt", pm)
+	}
+	if !pm.Amount.Equal(decimal.RequireFromString("19.90")) {
+		t.Fatalf("amount = %s, want 19.90", pm.Amount)
+	}
+	if posts != 1 || !pm.RequestedAt.Equal(seen[id]) {
+		t.Fatalf("posts = %d, requestedAt = %v, processor saw %v", posts, pm.RequestedAt, seen[id])
+	}
+
+	total, amount, err := p.db.Summary(context.Background(), "default", nil, nil)
+	if err != nil || total != 1 || !amount.Equal(decimal.RequireFromString("19.90")) {
+		t.Fatalf("summary = %d/%s (%v), want 1/19.90", total, amount, err)
+	}
+}
+
+func TestPipelineConfirmsAcceptedPayment(t *testing.T) {
+	// o provider grava mas responde 500: a confirmação acha e não paga de novo
+	stub, srv := newStubProcessor(t, http.StatusInternalServerError, true)
+	p := startPipeline(t, srv.URL, retry.Policy{MaxAttempts: 3, BaseBackoff: time.Millisecond})
+
+	id := uuid.New()
+	p.create(t, id, "5")
+	pm := p.await(t, id)
+
+	posts, seen := stub.snapshot()
+	if pm.Status != repo.StatusProcessed || posts != 1 {
+		t.Fatalf("status = %s after %d posts, want PROCESSED after 1", pm.Status, posts)
+	}
+	if !pm.RequestedAt.Equal(seen[id]) {
+		t.Fatalf("requestedAt = %v, processor saw %v", pm.RequestedAt, seen[id])
+	}
+}
+
+func TestPipelineMarksFailedAfterRetries(t *testing.T) {
+	stub, srv := newStubProcessor(t, http.StatusInternalServerError, false)
+	p := startPipeline(t, srv.URL, retry.Policy{MaxAttempts: 2, BaseBackoff: time.Millisecond})
+
+	id := uuid.New()
+	p.create(t, id, "5")
+	pm := p.await(t, id)
+
+	posts, _ := stub.snapshot()
+	if pm.Status != repo.StatusFailed || pm.Attempts != 2 || posts != 2 {
+		t.Fatalf("payment = %+v after %d posts, want FAILED after 2 attempts", pm, posts)
+	}
+	if pm.Provider != "default" || !strings.Contains(pm.LastError, "500") {
+		t.Fatalf("provider = %q, lastError = %q", pm.Provider, pm.LastError)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/auditor"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+)
+
+// Admin: endpoints operacionais (dead-letter etc.), fora do caminho da prova.
+type Admin struct {
+	db    repo.DB
+	token string
+	audit *auditor.Auditor
+}
+
+// NewAdmin: sem token o main nem monta as rotas /admin.
+func NewAdmin(db repo.DB, token string, audit *auditor.Auditor) *Admin {
+	return &Admin{db: db, token: token, audit: audit}
+}
+
+// Auth exige o header X-Admin-Token; token vazio recusa tudo.
+func (a *Admin) Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(a.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+const deadLetterDefaultLimit = 100
+
+// DeadLetter lista pagamentos FAILED com último erro e tentativas.
+func (a *Admin) DeadLetter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	limit := deadLetterDefaultLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	items, err := a.db.ListFailed(ctx, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if items == nil {
+		items = []repo.DeadLetter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+type requeueIn struct {
+	CorrelationIDs []uuid.UUID `json:"correlationIds"`
+	All            bool        `json:"all"`
+}
+
+// Requeue devolve FAILED para PENDING: ids selecionados ou, com "all": true, todos.
+func (a *Admin) Requeue(w http.ResponseWriter, r *http.Request) {
+	var in requeueIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// lista vazia sem "all" é quase sempre engano: não requeue tudo por acidente
+	if len(in.CorrelationIDs) == 0 && !in.All {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	ids := in.CorrelationIDs
+	if in.All {
+		ids = nil
+	}
+	n, err := a.db.Requeue(ctx, ids)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"requeued": n})
+}
+
+// WebhookDeliveries devolve o log de entregas de webhook de um pagamento.
+func (a *Admin) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "correlationId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	items, err := a.db.ListWebhookDeliveries(ctx, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if items == nil {
+		items = []repo.WebhookDelivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+// Reconciliation devolve o último relatório do auditor; com from e to, roda na hora
+// para essa janela.
+func (a *Admin) Reconciliation(w http.ResponseWriter, r *http.Request) {
+	fromStr, toStr := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromStr == "" && toStr == "" {
+		rep := a.audit.Last()
+		if rep == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rep)
+		return
+	}
+	from, to := repo.ParseISO(fromStr), repo.ParseISO(toStr)
+	if from == nil || to == nil || to.Before(*from) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// abaixo do middleware.Timeout(5s) do router
+	ctx, cancel := context.WithTimeout(r.Context(), 4500*time.Millisecond)
+	defer cancel()
+
+	rep := a.audit.Run(ctx, *from, *to)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rep)
+}
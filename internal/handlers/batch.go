@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	batchMaxItems = 5000
+	batchMaxBytes = 4 << 20
+)
+
+type batchResult struct {
+	Index         int        `json:"index"`
+	CorrelationID *uuid.UUID `json:"correlationId,omitempty"`
+	Result        string     `json:"result"` // new | duplicate | invalid
+	Error         string     `json:"error,omitempty"`
+}
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// CreatePaymentBatch aceita um array JSON ou NDJSON (Content-Type application/x-ndjson)
+// e insere todos os válidos em um único INSERT.
+func (h *Handler) CreatePaymentBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, batchMaxBytes)
+	raws, err := readBatch(r)
+	if err != nil {
+		if errors.Is(err, errBatchTooLarge) || errors.As(err, new(*http.MaxBytesError)) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, len(raws))
+	var valid []repo.NewPayment
+	var validIdx []int
+	for i, raw := range raws {
+		results[i] = batchResult{Index: i}
+		var in paymentIn
+		if err := json.Unmarshal(raw, &in); err != nil {
+			results[i].Result, results[i].Error = "invalid", "malformed json"
+			continue
+		}
+		if in.CorrelationID != uuid.Nil {
+			results[i].CorrelationID = &in.CorrelationID
+		}
+		if in.CorrelationID == uuid.Nil || !in.Amount.IsPositive() || !validCallbackURL(in.CallbackURL) {
+			results[i].Result, results[i].Error = "invalid", "correlationId, amount or callbackUrl invalid"
+			continue
+		}
+		if !validAmount(in.Amount) {
+			results[i].Result, results[i].Error = "invalid", "amount exceeds numeric(18,2)"
+			continue
+		}
+		valid = append(valid, repo.NewPayment{CorrelationID: in.CorrelationID, Amount: in.Amount, CallbackURL: in.CallbackURL})
+		validIdx = append(validIdx, i)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	// um span para o lote; cada linha guarda o traceparent dele
+	ctx, sp := tracing.Start(ctx, "payment.batch_intake", attribute.Int("payment.batch_size", len(valid)))
+	tp := tracing.TraceParent(ctx)
+	for j := range valid {
+		valid[j].TraceParent = tp
+	}
+	already, err := h.db.EnsureUniqueBatch(ctx, valid)
+	tracing.End(sp, err)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	counts := map[string]int{"new": 0, "duplicate": 0, "invalid": len(raws) - len(valid)}
+	for j, i := range validIdx {
+		if already[j] {
+			results[i].Result = "duplicate"
+		} else {
+			results[i].Result = "new"
+		}
+		counts[results[i].Result]++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"new":       counts["new"],
+		"duplicate": counts["duplicate"],
+		"invalid":   counts["invalid"],
+		"results":   results,
+	})
+}
+
+// readBatch separa o corpo em itens crus; cada item é validado individualmente.
+func readBatch(r *http.Request) ([]json.RawMessage, error) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct == "application/x-ndjson" || ct == "application/jsonl" {
+		var out []json.RawMessage
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(make([]byte, 0, 64<<10), batchMaxBytes)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(out) == batchMaxItems {
+				return nil, errBatchTooLarge
+			}
+			out = append(out, json.RawMessage(append([]byte(nil), line...)))
+		}
+		return out, sc.Err()
+	}
+
+	var out []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&out); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(out) > batchMaxItems {
+		return nil, errBatchTooLarge
+	}
+	return out, nil
+}
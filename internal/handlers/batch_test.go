@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/shopspring/decimal"
+)
+
+func testHandler(t *testing.T, db repo.DB) *Handler {
+	t.Helper()
+	reg, err := processors.NewRegistry([]processors.Spec{
+		{Name: "default", BaseURL: "http://default", Fee: 0.05},
+		{Name: "fallback", BaseURL: "http://fallback", Priority: 1, Fee: 0.15},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(db, reg)
+}
+
+func TestCreatePaymentBatchMixed(t *testing.T) {
+	db := repo.NewMemDB()
+	h := testHandler(t, db)
+
+	existing := uuid.New()
+	if _, err := db.EnsureUnique(context.Background(), existing, mustDec("5"), ""); err != nil {
+		t.Fatal(err)
+	}
+	fresh, repeated := uuid.New(), uuid.New()
+	items := []string{
+		`{"correlationId":"` + fresh.String() + `","amount":19.90}`,
+		`{"correlationId":"` + existing.String() + `","amount":5}`,
+		`{"correlationId":"` + repeated.String() + `","amount":1}`,
+		`{"correlationId":"` + repeated.String() + `","amount":1}`,
+		`{"correlationId":"` + uuid.NewString() + `","amount":10000000000000000}`,
+		`{"correlationId":"` + uuid.NewString() + `","amount":1.001}`,
+		`{"correlationId":"` + uuid.NewString() + `","amount":0}`,
+		`{"correlationId":"` + uuid.NewString() + `","amount":9999999999999999.99}`,
+		`{"amount":1}`,
+		`not json`,
+	}
+	want := []string{"new", "duplicate", "new", "duplicate", "invalid", "invalid", "invalid", "new", "invalid", "invalid"}
+
+	req := httptest.NewRequest(http.MethodPost, "/payments/batch", strings.NewReader(strings.Join(items, "\n")))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	h.CreatePaymentBatch(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", rec.Code, rec.Body)
+	}
+
+	var out struct {
+		New, Duplicate, Invalid int
+		Results                 []batchResult
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.New != 3 || out.Duplicate != 2 || out.Invalid != 5 || len(out.Results) != len(items) {
+		t.Fatalf("counts = %d/%d/%d over %d results, want 3/2/5 over %d", out.New, out.Duplicate, out.Invalid, len(out.Results), len(items))
+	}
+	for i, r := range out.Results {
+		if r.Index != i || r.Result != want[i] {
+			t.Errorf("results[%d] = %+v, want %s", i, r, want[i])
+		}
+	}
+	if pending, _, _ := db.Backlog(context.Background()); pending != 4 {
+		t.Fatalf("pending = %d, want 4 (existing + 3 new)", pending)
+	}
+}
+
+func TestCreatePaymentBatchTooLarge(t *testing.T) {
+	h := testHandler(t, repo.NewMemDB())
+	body := "[" + strings.TrimSuffix(strings.Repeat(`{},`, batchMaxItems+1), ",") + "]"
+	rec := httptest.NewRecorder()
+	h.CreatePaymentBatch(rec, httptest.NewRequest(http.MethodPost, "/payments/batch", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", rec.Code)
+	}
+}
+
+func mustDec(s string) decimal.Decimal { return decimal.RequireFromString(s) }
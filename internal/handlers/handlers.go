@@ -3,25 +3,51 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
 	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Handler struct {
-	db repo.DB
+	db  repo.DB
+	reg *processors.Registry
 }
 
-func New(db repo.DB) *Handler {
-	return &Handler{db: db}
+func New(db repo.DB, reg *processors.Registry) *Handler {
+	return &Handler{db: db, reg: reg}
 }
 
 type paymentIn struct {
 	CorrelationID uuid.UUID       `json:"correlationId"`
 	Amount        decimal.Decimal `json:"amount"`
+	CallbackURL   string          `json:"callbackUrl"` // opcional: webhook em PROCESSED/FAILED
+}
+
+func validCallbackURL(s string) bool {
+	if s == "" {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// maxAmount: payments.amount é numeric(18,2) — até 16 dígitos inteiros
+var maxAmount = decimal.New(1, 16)
+
+// validAmount: cabe em numeric(18,2) sem arredondar (positividade é checada à parte)
+func validAmount(d decimal.Decimal) bool {
+	return d.LessThan(maxAmount) && d.Equal(d.Round(2))
 }
 
 func (h *Handler) CreatePayment(w http.ResponseWriter, r *http.Request) {
@@ -30,16 +56,25 @@ func (h *Handler) CreatePayment(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if in.CorrelationID == uuid.Nil || !in.Amount.IsPositive() {
+	if in.CorrelationID == uuid.Nil || !in.Amount.IsPositive() || !validCallbackURL(in.CallbackURL) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	// fora de numeric(18,2) falharia no INSERT — e, coalescido, junto com os vizinhos
+	if !validAmount(in.Amount) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
 
 	// caminho super curto: só enfileira e responde
 	ctx, cancel := context.WithTimeout(r.Context(), 450*time.Millisecond) // 250 -> 450
 	defer cancel()
 
-	already, err := h.db.EnsureUnique(ctx, in.CorrelationID, in.Amount)
+	// o traceparent deste span vai junto da linha: dispatcher/reconciler continuam o trace
+	ctx, sp := tracing.Start(ctx, "payment.intake", attribute.String("payment.correlation_id", in.CorrelationID.String()))
+	already, err := h.db.EnsureUnique(ctx, in.CorrelationID, in.Amount, in.CallbackURL)
+	sp.SetAttributes(attribute.Bool("payment.duplicate", already))
+	tracing.End(sp, err)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -59,19 +94,219 @@ func (h *Handler) CreatePayment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+type paymentOut struct {
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Status        repo.Status     `json:"status"`
+	Provider      *repo.Provider  `json:"provider"` // null enquanto não despachado
+	Amount        decimal.Decimal `json:"amount"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+	Attempts      int             `json:"attempts"`
+	LastError     *string         `json:"lastError"`
+}
+
+func (h *Handler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "correlationId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 450*time.Millisecond)
+	defer cancel()
+
+	pm, err := h.db.GetPayment(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	out := paymentOut{
+		CorrelationID: pm.CorrelationID,
+		Status:        pm.Status,
+		Amount:        pm.Amount,
+		RequestedAt:   pm.RequestedAt.UTC(),
+		Attempts:      pm.Attempts,
+	}
+	if pm.Provider != repo.ProviderUnassigned {
+		out.Provider = &pm.Provider
+	}
+	if pm.LastError != "" {
+		out.LastError = &pm.LastError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+type seriesPointOut struct {
+	Bucket        time.Time       `json:"bucket"`
+	TotalRequests int64           `json:"totalRequests"`
+	TotalAmount   decimal.Decimal `json:"totalAmount"`
+}
+
+// SummarySeries: mesmo filtro do Summary, quebrado por bucket (minute/hour/day).
+func (h *Handler) SummarySeries(w http.ResponseWriter, r *http.Request) {
+	bucket, err := repo.ParseBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	from, to := repo.ParseISO(r.URL.Query().Get("from")), repo.ParseISO(r.URL.Query().Get("to"))
+	points, err := h.db.SummarySeries(ctx, bucket, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	series := make(map[string][]seriesPointOut, len(h.reg.All()))
+	for _, spec := range h.reg.All() {
+		series[string(spec.Name)] = []seriesPointOut{}
+	}
+	for _, p := range points {
+		if _, ok := series[string(p.Provider)]; !ok {
+			continue
+		}
+		series[string(p.Provider)] = append(series[string(p.Provider)], seriesPointOut{
+			Bucket:        p.Bucket,
+			TotalRequests: p.Count,
+			TotalAmount:   p.Amount,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"bucket": bucket, "series": series})
+}
+
+type refundIn struct {
+	RefundID uuid.UUID        `json:"refundId"` // opcional: chave de idempotência
+	Amount   *decimal.Decimal `json:"amount"`   // opcional: padrão = valor restante
+}
+
+func (h *Handler) Refund(w http.ResponseWriter, r *http.Request) {
+	cid, err := uuid.Parse(chi.URLParam(r, "correlationId"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var in refundIn
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil && !errors.Is(err, io.EOF) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if in.Amount != nil && !in.Amount.IsPositive() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if in.RefundID == uuid.Nil {
+		in.RefundID = uuid.New()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 450*time.Millisecond)
+	defer cancel()
+
+	rf, created, err := h.db.CreateRefund(ctx, in.RefundID, cid, in.Amount)
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrNotRefundable), errors.Is(err, repo.ErrRefundIDConflict):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case errors.Is(err, repo.ErrRefundExceeds):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !created {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(rf)
+}
+
+type statusTotalOut struct {
+	Count  int64           `json:"count"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// Summary: totais PROCESSED por provider; com includeStatuses=true acrescenta
+// byStatus/refundsByStatus (e a chave "unassigned" para o que ainda não foi despachado).
 func (h *Handler) Summary(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
-  defer cancel()
+	defer cancel()
 
 	fromStr := r.URL.Query().Get("from")
 	toStr := r.URL.Query().Get("to")
 	from, to := repo.ParseISO(fromStr), repo.ParseISO(toStr)
+	withStatuses, _ := strconv.ParseBool(r.URL.Query().Get("includeStatuses"))
 
-	defCnt, defAmt, _ := h.db.Summary(ctx, repo.ProviderDefault, from, to)
-	fbCnt, fbAmt, _ := h.db.Summary(ctx, repo.ProviderFallback, from, to)
+	// sem includeStatuses (o caminho pontuado) fica só nos PROCESSED: rollups + bordas
+	var totals []repo.SummaryTotal
+	var err error
+	if withStatuses {
+		totals, err = h.db.SummaryBreakdown(ctx, from, to)
+	} else {
+		totals, err = h.db.SummaryProcessed(ctx, from, to)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	byStatus := map[repo.Provider]map[repo.Status]statusTotalOut{}
+	refundsByStatus := map[repo.Provider]map[repo.Status]statusTotalOut{}
+	for _, t := range totals {
+		m := byStatus
+		if t.Refund {
+			m = refundsByStatus
+		}
+		if m[t.Provider] == nil {
+			m[t.Provider] = map[repo.Status]statusTotalOut{}
+		}
+		m[t.Provider][t.Status] = statusTotalOut{Count: t.Count, Amount: t.Amount}
+	}
 
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"default":  map[string]any{"totalRequests": defCnt, "totalAmount": defAmt},
-		"fallback": map[string]any{"totalRequests": fbCnt, "totalAmount": fbAmt},
-	})
+	out := make(map[string]any, len(h.reg.All())+1)
+	for _, spec := range h.reg.All() {
+		p := repo.Provider(spec.Name)
+		done, refunded := byStatus[p][repo.StatusProcessed], refundsByStatus[p][repo.StatusProcessed]
+		cnt, amt := done.Count, done.Amount
+		rfCnt, rfAmt := refunded.Count, refunded.Amount
+		entry := map[string]any{
+			"totalRequests":  cnt,
+			"totalAmount":    amt,
+			"totalFee":       spec.FeeForTotal(cnt, amt).Round(2), // estimado pela config de fees
+			"totalRefunds":   rfCnt,
+			"refundedAmount": rfAmt,
+			"netAmount":      amt.Sub(rfAmt),
+		}
+		if withStatuses {
+			entry["byStatus"] = statusMap(byStatus[p])
+			entry["refundsByStatus"] = statusMap(refundsByStatus[p])
+		}
+		out[string(spec.Name)] = entry
+	}
+	if withStatuses {
+		out["unassigned"] = map[string]any{"byStatus": statusMap(byStatus[repo.ProviderUnassigned])}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// statusMap: todos os status presentes, zerados quando não há linhas
+func statusMap(m map[repo.Status]statusTotalOut) map[repo.Status]statusTotalOut {
+	out := make(map[repo.Status]statusTotalOut, 4)
+	for _, s := range []repo.Status{repo.StatusPending, repo.StatusDispatching, repo.StatusProcessed, repo.StatusFailed} {
+		out[s] = m[s]
+	}
+	return out
 }
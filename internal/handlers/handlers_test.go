@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+)
+
+func TestCreatePayment(t *testing.T) {
+	db := repo.NewMemDB()
+	h := testHandler(t, db)
+	id := uuid.New()
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"new", `{"correlationId":"` + id.String() + `","amount":19.90}`, http.StatusAccepted},
+		{"duplicate", `{"correlationId":"` + id.String() + `","amount":19.90}`, http.StatusOK},
+		{"not json", `{`, http.StatusBadRequest},
+		{"no id", `{"amount":1}`, http.StatusBadRequest},
+		{"zero amount", `{"correlationId":"` + uuid.NewString() + `","amount":0}`, http.StatusBadRequest},
+		{"bad callback", `{"correlationId":"` + uuid.NewString() + `","amount":1,"callbackUrl":"ftp://x"}`, http.StatusBadRequest},
+		{"too large", `{"correlationId":"` + uuid.NewString() + `","amount":10000000000000000}`, http.StatusUnprocessableEntity},
+		{"wrong scale", `{"correlationId":"` + uuid.NewString() + `","amount":1.001}`, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		h.CreatePayment(rec, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tc.body)))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+	if pending, _, _ := db.Backlog(context.Background()); pending != 1 {
+		t.Fatalf("pending = %d, want 1", pending)
+	}
+}
+
+func TestGetPayment(t *testing.T) {
+	db := repo.NewMemDB()
+	h := testHandler(t, db)
+	id := uuid.New()
+	if _, err := db.EnsureUnique(context.Background(), id, mustDec("19.90"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(param string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/payments/"+param, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("correlationId", param)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rec := httptest.NewRecorder()
+		h.GetPayment(rec, req)
+		return rec
+	}
+
+	rec := get(id.String())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var out paymentOut
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	// PENDING ainda sem provider: sai null, não ""
+	if out.CorrelationID != id || out.Status != repo.StatusPending || out.Provider != nil || !out.Amount.Equal(mustDec("19.90")) {
+		t.Fatalf("payment = %+v", out)
+	}
+
+	if rec := get(uuid.NewString()); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status = %d, want 404", rec.Code)
+	}
+	if rec := get("nope"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/shopspring/decimal"
+)
+
+// breakdownSpy conta quem o Summary consultou.
+type breakdownSpy struct {
+	*repo.MemDB
+	breakdowns, processed atomic.Int32
+}
+
+func (s *breakdownSpy) SummaryBreakdown(ctx context.Context, from, to *time.Time) ([]repo.SummaryTotal, error) {
+	s.breakdowns.Add(1)
+	return s.MemDB.SummaryBreakdown(ctx, from, to)
+}
+
+func (s *breakdownSpy) SummaryProcessed(ctx context.Context, from, to *time.Time) ([]repo.SummaryTotal, error) {
+	s.processed.Add(1)
+	return s.MemDB.SummaryProcessed(ctx, from, to)
+}
+
+// seedSummary: 2 PROCESSED no default (10 + 20, estorno de 5), 1 FAILED no fallback, 1 PENDING.
+func seedSummary(t *testing.T, db *repo.MemDB) {
+	t.Helper()
+	ctx := context.Background()
+	for _, amt := range []string{"10", "20", "7", "3"} {
+		if _, err := db.EnsureUnique(ctx, uuid.New(), mustDec(amt), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, _ := db.ClaimPendingBatch(ctx, "a", time.Minute, 4)
+	now := time.Now().UTC()
+	for _, it := range items {
+		if it.Amount.Equal(mustDec("3")) {
+			if err := db.Release(ctx, it.CorrelationID, "a"); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if it.Amount.Equal(mustDec("7")) {
+			if err := db.MarkFailed(ctx, it.CorrelationID, "a", "fallback", now, "boom"); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := db.Finish(ctx, it.CorrelationID, "a", "default", repo.StatusProcessed, now); err != nil {
+			t.Fatal(err)
+		}
+		if it.Amount.Equal(mustDec("20")) {
+			five := mustDec("5")
+			rf, _, err := db.CreateRefund(ctx, uuid.New(), it.CorrelationID, &five)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.FinishRefund(ctx, rf.ID, repo.StatusProcessed, "", time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func getSummary(t *testing.T, h *Handler, query string) map[string]map[string]json.RawMessage {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Summary(rec, httptest.NewRequest(http.MethodGet, "/payments-summary"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var out map[string]map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSummarySkipsBreakdownByDefault(t *testing.T) {
+	spy := &breakdownSpy{MemDB: repo.NewMemDB()}
+	seedSummary(t, spy.MemDB)
+	h := testHandler(t, spy)
+
+	plain := getSummary(t, h, "")
+	if spy.breakdowns.Load() != 0 || spy.processed.Load() != 1 {
+		t.Fatalf("default summary: %d breakdowns, %d processed queries; want 0/1", spy.breakdowns.Load(), spy.processed.Load())
+	}
+	if _, ok := plain["default"]["byStatus"]; ok {
+		t.Fatalf("byStatus present without includeStatuses")
+	}
+
+	full := getSummary(t, h, "?includeStatuses=true")
+	if spy.breakdowns.Load() != 1 {
+		t.Fatalf("includeStatuses did not use the breakdown")
+	}
+	for _, field := range []string{"totalRequests", "totalAmount", "totalFee", "totalRefunds", "refundedAmount", "netAmount"} {
+		for _, p := range []string{"default", "fallback"} {
+			if string(plain[p][field]) != string(full[p][field]) {
+				t.Errorf("%s.%s = %s without statuses, %s with", p, field, plain[p][field], full[p][field])
+			}
+		}
+	}
+
+	var n int64
+	var amt, net decimal.Decimal
+	_ = json.Unmarshal(plain["default"]["totalRequests"], &n)
+	_ = json.Unmarshal(plain["default"]["totalAmount"], &amt)
+	_ = json.Unmarshal(plain["default"]["netAmount"], &net)
+	if n != 2 || !amt.Equal(mustDec("30")) || !net.Equal(mustDec("25")) {
+		t.Fatalf("default = %d/%s net %s, want 2/30 net 25", n, amt, net)
+	}
+	if _, ok := full["unassigned"]["byStatus"]; !ok {
+		t.Fatalf("unassigned byStatus missing with includeStatuses")
+	}
+}
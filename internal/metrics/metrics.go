@@ -0,0 +1,156 @@
+// Package metrics concentra os coletores Prometheus expostos em /metrics.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// buckets em segundos, apertados embaixo: o caminho quente fica na casa dos ms
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rinha_http_request_duration_seconds",
+		Help:    "Latência das requisições HTTP por rota.",
+		Buckets: latencyBuckets,
+	}, []string{"method", "route", "code"})
+
+	payDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rinha_processor_pay_duration_seconds",
+		Help:    "Latência do Pay por provider e resultado (ok, error, timeout).",
+		Buckets: latencyBuckets,
+	}, []string{"provider", "outcome"})
+
+	deciderChoices = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rinha_decider_choices_total",
+		Help: "Escolhas do Decider por provider.",
+	}, []string{"provider"})
+
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rinha_decider_breaker_state",
+		Help: "Estado do breaker por provider (0 closed, 1 open, 2 half-open).",
+	}, []string{"provider"})
+
+	breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rinha_decider_breaker_transitions_total",
+		Help: "Transições de breaker por provider e estado de destino.",
+	}, []string{"provider", "to", "origin"})
+
+	dispatchBatch = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rinha_dispatcher_claim_batch_size",
+		Help:    "Itens por ClaimPendingBatch que trouxe trabalho.",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128},
+	})
+
+	reconcilerProbes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rinha_reconciler_probes_total",
+		Help: "Consultas do reconciler ao provider por resultado (found, not_found).",
+	}, []string{"provider", "outcome"})
+
+	backlog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rinha_payments_backlog",
+		Help: "Pagamentos PENDING/DISPATCHING na base (amostrado).",
+	}, []string{"status"})
+)
+
+// Handler expõe o registry padrão.
+func Handler() http.Handler { return promhttp.Handler() }
+
+// HTTP mede cada requisição pelo padrão de rota do chi (não pela URL crua).
+func HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			route = rc.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		httpDuration.WithLabelValues(r.Method, route, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObservePay registra uma chamada Pay ao provider.
+func ObservePay(provider string, d time.Duration, err error) {
+	payDuration.WithLabelValues(provider, outcome(err)).Observe(d.Seconds())
+}
+
+func outcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return "timeout"
+	}
+	return "error"
+}
+
+func DeciderChoice(provider string) { deciderChoices.WithLabelValues(provider).Inc() }
+
+// BreakerState: state segue a numeração de decider.BreakerState.
+func BreakerState(provider string, state int) {
+	breakerState.WithLabelValues(provider).Set(float64(state))
+}
+
+// Breaker registra uma transição (estado atual + contador).
+func Breaker(provider string, state int, to string, remote bool) {
+	BreakerState(provider, state)
+	origin := "local"
+	if remote {
+		origin = "remote"
+	}
+	breakerTransitions.WithLabelValues(provider, to, origin).Inc()
+}
+
+func DispatchBatch(n int) { dispatchBatch.Observe(float64(n)) }
+
+func ReconcilerProbe(provider string, found bool) {
+	out := "not_found"
+	if found {
+		out = "found"
+	}
+	reconcilerProbes.WithLabelValues(provider, out).Inc()
+}
+
+// StartBacklog amostra PENDING/DISPATCHING a cada every (fora do caminho do scrape).
+func StartBacklog(ctx context.Context, db repo.DB, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				qctx, cancel := context.WithTimeout(ctx, every)
+				pending, dispatching, err := db.Backlog(qctx)
+				cancel()
+				if err != nil {
+					log.Printf("metrics backlog err: %v", err)
+					continue
+				}
+				backlog.WithLabelValues(string(repo.StatusPending)).Set(float64(pending))
+				backlog.WithLabelValues(string(repo.StatusDispatching)).Set(float64(dispatching))
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package notifier
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errBlockedAddr: callbackUrl resolveu para endereço interno; não adianta repetir.
+var errBlockedAddr = errors.New("callback address not allowed")
+
+// sharedCGNAT: 100.64.0.0/10, fora de netip.Addr.IsPrivate mas igualmente interno.
+var sharedCGNAT = netip.MustParsePrefix("100.64.0.0/10")
+
+// blockedIP: loopback, redes privadas, link-local (inclui metadata de cloud),
+// multicast e não especificado.
+func blockedIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedCGNAT.Contains(ip)
+}
+
+// newHTTPClient: a checagem é no IP já resolvido, dentro do dial, para valer
+// também em redirects e contra DNS que muda entre validação e conexão.
+// Sem proxy do ambiente: o destino real é o que precisa passar pelo filtro.
+func newHTTPClient(allowPrivate bool) *http.Client {
+	d := &net.Dialer{Timeout: deliveryTimeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		d.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", errBlockedAddr, address)
+			}
+			if blockedIP(ap.Addr()) {
+				return fmt.Errorf("%w: %s", errBlockedAddr, ap.Addr())
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			DialContext:         d.DialContext,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     30 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestBlockedIP(t *testing.T) {
+	cases := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.10", true},
+		{"fd00::1", true},
+		{"100.64.0.1", true},      // CGNAT
+		{"169.254.169.254", true}, // metadata de cloud
+		{"fe80::1", true},
+		{"224.0.0.1", true},
+		{"239.255.255.250", true},
+		{"ff02::1", true},
+		{"ff01::1", true}, // interface-local
+		{"0.0.0.0", true},
+		{"::", true},
+		{"::ffff:127.0.0.1", true}, // IPv4 mapeado em IPv6
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"8.8.8.8", false},
+		{"100.128.0.1", false}, // logo depois do CGNAT
+		{"2001:4860:4860::8888", false},
+		{"::ffff:1.1.1.1", false},
+	}
+	for _, tc := range cases {
+		if got := blockedIP(netip.MustParseAddr(tc.addr)); got != tc.blocked {
+			t.Errorf("blockedIP(%s) = %v, want %v", tc.addr, got, tc.blocked)
+		}
+	}
+}
+
+func TestHTTPClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	if _, err := newHTTPClient(false).Do(req); !errors.Is(err, errBlockedAddr) {
+		t.Fatalf("err = %v, want errBlockedAddr", err)
+	}
+	resp, err := newHTTPClient(true).Do(req)
+	if err != nil {
+		t.Fatalf("allowPrivate: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	loopEvery       = 200 * time.Millisecond
+	batchSize       = 32
+	deliveryTimeout = 2 * time.Second
+	claimVisibility = 30 * time.Second // entrega reivindicada some da fila por esse tempo
+)
+
+// Options configura a entrega dos webhooks.
+type Options struct {
+	Secret       string // chave do HMAC; vazio = sem assinatura
+	Retry        retry.Policy
+	Workers      int  // entregas simultâneas; um endpoint lento não trava os outros
+	AllowPrivate bool // libera callbacks para loopback/rede interna (só dev local)
+}
+
+// Payload enviado no callback.
+type Payload struct {
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Status        repo.Status     `json:"status"`
+	Provider      string          `json:"provider"`
+	Amount        decimal.Decimal `json:"amount"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+	LastError     string          `json:"lastError,omitempty"`
+}
+
+// Start entrega os webhooks enfileirados em webhook_deliveries. Cada POST leva
+// X-Webhook-Id, X-Webhook-Timestamp e, com Secret, X-Webhook-Signature =
+// sha256=hex(HMAC(secret, timestamp + "." + body)).
+func Start(ctx context.Context, db repo.DB, opts Options) {
+	workers := max(opts.Workers, 1)
+	go func() {
+		t := time.NewTicker(loopEvery)
+		defer t.Stop()
+		httpc := newHTTPClient(opts.AllowPrivate)
+		// só reivindica o que tem worker livre para entregar já
+		slots := make(chan struct{}, workers)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				free := workers - len(slots)
+				if free <= 0 {
+					continue
+				}
+				items, err := db.ClaimWebhooks(ctx, claimVisibility, min(free, batchSize))
+				if err != nil || len(items) == 0 {
+					continue
+				}
+				for _, wh := range items {
+					slots <- struct{}{}
+					go func() {
+						defer func() { <-slots }()
+						deliver(ctx, db, httpc, opts, wh)
+					}()
+				}
+			}
+		}
+	}()
+}
+
+func deliver(ctx context.Context, db repo.DB, httpc *http.Client, opts Options, wh repo.Webhook) {
+	code, err := send(ctx, httpc, opts.Secret, wh)
+	switch {
+	case err == nil:
+		_ = db.RecordWebhookAttempt(ctx, wh.ID, repo.WebhookDelivered, code, "", time.Now())
+	case permanent(code) || errors.Is(err, errBlockedAddr) || opts.Retry.Exhausted(wh.Attempts):
+		log.Printf("webhook %d (%s) failed for good after %d attempts: %v", wh.ID, wh.CorrelationID, wh.Attempts, err)
+		_ = db.RecordWebhookAttempt(ctx, wh.ID, repo.WebhookFailed, code, err.Error(), time.Now())
+	default:
+		next := time.Now().Add(opts.Retry.Backoff(wh.Attempts))
+		_ = db.RecordWebhookAttempt(ctx, wh.ID, repo.WebhookPending, code, err.Error(), next)
+	}
+}
+
+func send(ctx context.Context, httpc *http.Client, secret string, wh repo.Webhook) (int, error) {
+	body, _ := json.Marshal(Payload{
+		CorrelationID: wh.CorrelationID,
+		Status:        wh.Event,
+		Provider:      string(wh.Provider),
+		Amount:        wh.Amount,
+		RequestedAt:   wh.RequestedAt.UTC(),
+		LastError:     wh.LastError,
+	})
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(wh.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	if secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+Sign(secret, ts, body))
+	}
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("callback status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign calcula a assinatura para quem recebe poder validar o callback.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// permanent: 4xx diferente de 408/429 não adianta repetir.
+func permanent(code int) bool {
+	return code/100 == 4 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
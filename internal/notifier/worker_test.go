@@ -0,0 +1,166 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
+	"github.com/shopspring/decimal"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"correlationId":"x"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if got := Sign("s3cret", "1700000000", body); got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", "1700000000", body) == want || Sign("s3cret", "1700000001", body) == want {
+		t.Fatal("signature ignores secret or timestamp")
+	}
+}
+
+func TestSendSignsBody(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Clone(), b}
+	}))
+	defer srv.Close()
+
+	wh := repo.Webhook{ID: 7, CorrelationID: uuid.New(), URL: srv.URL, Event: repo.StatusProcessed,
+		Provider: "default", Amount: decimal.RequireFromString("19.90"), RequestedAt: time.Now()}
+	if code, err := send(context.Background(), newHTTPClient(true), "s3cret", wh); err != nil || code != http.StatusOK {
+		t.Fatalf("send = %d, %v", code, err)
+	}
+	r := <-got
+
+	ts := r.header.Get("X-Webhook-Timestamp")
+	if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+		t.Fatalf("timestamp %q: %v", ts, err)
+	}
+	if sig := r.header.Get("X-Webhook-Signature"); sig != "sha256="+Sign("s3cret", ts, r.body) {
+		t.Fatalf("signature = %q does not match timestamp.body", sig)
+	}
+	if r.header.Get("X-Webhook-Id") != "7" {
+		t.Fatalf("X-Webhook-Id = %q, want 7", r.header.Get("X-Webhook-Id"))
+	}
+	var p Payload
+	if err := json.Unmarshal(r.body, &p); err != nil || p.CorrelationID != wh.CorrelationID || p.Status != repo.StatusProcessed {
+		t.Fatalf("payload = %+v (%v)", p, err)
+	}
+
+	// sem secret não assina
+	if _, err := send(context.Background(), newHTTPClient(true), "", wh); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-got; r.header.Get("X-Webhook-Signature") != "" {
+		t.Fatalf("unsigned delivery carries %q", r.header.Get("X-Webhook-Signature"))
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	for code, want := range map[int]bool{
+		0: false, 200: false, 301: false,
+		400: true, 401: true, 404: true, 410: true, 422: true,
+		408: false, 429: false,
+		500: false, 502: false, 503: false,
+	} {
+		if got := permanent(code); got != want {
+			t.Errorf("permanent(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+// seedWebhook: pagamento com callback levado a PROCESSED, entrega já reivindicada.
+func seedWebhook(t *testing.T, db *repo.MemDB, url string) repo.Webhook {
+	t.Helper()
+	ctx := context.Background()
+	id := uuid.New()
+	if _, err := db.EnsureUnique(ctx, id, decimal.RequireFromString("10"), url); err != nil {
+		t.Fatal(err)
+	}
+	items, _ := db.ClaimPendingBatch(ctx, "a", time.Minute, 1)
+	if len(items) != 1 {
+		t.Fatalf("claimed %d, want 1", len(items))
+	}
+	if err := db.Finish(ctx, id, "a", "default", repo.StatusProcessed, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	whs, _ := db.ClaimWebhooks(ctx, time.Minute, 1)
+	if len(whs) != 1 {
+		t.Fatalf("claimed %d webhooks, want 1", len(whs))
+	}
+	return whs[0]
+}
+
+func TestDeliverStatusSplit(t *testing.T) {
+	cases := []struct {
+		code int
+		want repo.WebhookStatus
+	}{
+		{200, repo.WebhookDelivered},
+		{204, repo.WebhookDelivered},
+		{400, repo.WebhookFailed},
+		{404, repo.WebhookFailed},
+		{410, repo.WebhookFailed},
+		{408, repo.WebhookPending},
+		{429, repo.WebhookPending},
+		{500, repo.WebhookPending},
+		{503, repo.WebhookPending},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.code)
+		}))
+		db := repo.NewMemDB()
+		wh := seedWebhook(t, db, srv.URL)
+		opts := Options{AllowPrivate: true, Retry: retry.Policy{MaxAttempts: 5, BaseBackoff: time.Second}}
+		deliver(context.Background(), db, newHTTPClient(true), opts, wh)
+		srv.Close()
+
+		ds, _ := db.ListWebhookDeliveries(context.Background(), wh.CorrelationID)
+		if len(ds) != 1 || ds[0].Status != tc.want || ds[0].LastCode != tc.code {
+			t.Errorf("%d: deliveries = %+v, want %s", tc.code, ds, tc.want)
+		}
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// retryável, mas sem tentativas sobrando
+	db := repo.NewMemDB()
+	wh := seedWebhook(t, db, srv.URL)
+	deliver(context.Background(), db, newHTTPClient(true), Options{Retry: retry.Policy{MaxAttempts: 1}}, wh)
+	if ds, _ := db.ListWebhookDeliveries(context.Background(), wh.CorrelationID); ds[0].Status != repo.WebhookFailed {
+		t.Errorf("exhausted: status = %s, want FAILED", ds[0].Status)
+	}
+
+	// endereço interno: falha de vez na primeira tentativa
+	db = repo.NewMemDB()
+	wh = seedWebhook(t, db, srv.URL)
+	deliver(context.Background(), db, newHTTPClient(false), Options{Retry: retry.Policy{MaxAttempts: 5}}, wh)
+	if ds, _ := db.ListWebhookDeliveries(context.Background(), wh.CorrelationID); ds[0].Status != repo.WebhookFailed {
+		t.Errorf("blocked: status = %s, want FAILED", ds[0].Status)
+	}
+}
@@ -6,35 +6,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/metrics"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Provider string
 
-const (
-	ProviderDefault  Provider = "default"
-	ProviderFallback Provider = "fallback"
-)
-
 type Client struct {
-	defaultURL  string
-	fallbackURL string
-	http        *http.Client
+	reg   *Registry
+	http  *http.Client
+	admin *http.Client // admin summary: fora do caminho quente, timeout maior
+
+	adminToken string
 }
 
-func NewClient(defURL, fbURL string) *Client {
+func NewClient(reg *Registry) *Client {
 	return &Client{
-		defaultURL:  defURL,
-		fallbackURL: fbURL,
-		http:        &http.Client{Timeout: 550 * time.Millisecond},
+		reg:   reg,
+		http:  &http.Client{Timeout: 550 * time.Millisecond},
+		admin: &http.Client{Timeout: 2 * time.Second},
 	}
 }
 
-func (c *Client) DefaultBase() string  { return c.defaultURL }
-func (c *Client) FallbackBase() string { return c.fallbackURL }
+// SetAdminToken define o X-Rinha-Token usado nos endpoints /admin dos processors.
+func (c *Client) SetAdminToken(token string) { c.adminToken = token }
+
+func (c *Client) Registry() *Registry { return c.reg }
+
+// Base devolve a URL base do provider ("" se não estiver registrado).
+func (c *Client) Base(provider Provider) string {
+	s, _ := c.reg.Get(provider)
+	return s.BaseURL
+}
+
+func (c *Client) baseFor(provider Provider) (string, error) {
+	s, ok := c.reg.Get(provider)
+	if !ok {
+		return "", fmt.Errorf("unknown provider: %q", provider)
+	}
+	return s.BaseURL, nil
+}
 
 type payReq struct {
 	CorrelationID uuid.UUID       `json:"correlationId"`
@@ -43,13 +60,22 @@ type payReq struct {
 }
 
 func (c *Client) Pay(ctx context.Context, provider Provider, id uuid.UUID, amount decimal.Decimal, sentAt time.Time) error {
-	body, _ := json.Marshal(payReq{CorrelationID: id, Amount: amount, RequestedAt: sentAt})
-	url := c.defaultURL
-	if provider == ProviderFallback {
-		url = c.fallbackURL
+	url, err := c.baseFor(provider)
+	if err != nil {
+		return err
 	}
+	body, _ := json.Marshal(payReq{CorrelationID: id, Amount: amount, RequestedAt: sentAt})
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/payments", url), bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	req, sp := tracing.StartClient(req, "processor.pay", attribute.String("processor.provider", string(provider)))
+	start := time.Now()
+	err = c.do(req)
+	metrics.ObservePay(string(provider), time.Since(start), err)
+	tracing.End(sp, err)
+	return err
+}
+
+func (c *Client) do(req *http.Request) error {
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return err
@@ -61,15 +87,44 @@ func (c *Client) Pay(ctx context.Context, provider Provider, id uuid.UUID, amoun
 	return nil
 }
 
+type refundReq struct {
+	RefundID      uuid.UUID       `json:"refundId"`
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Amount        decimal.Decimal `json:"amount"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+}
+
+// Refund pede o estorno ao provider que processou o pagamento. O provider deve
+// tratar refundId como chave de idempotência.
+func (c *Client) Refund(ctx context.Context, provider Provider, refundID, correlationID uuid.UUID, amount decimal.Decimal, requestedAt time.Time) error {
+	url, err := c.baseFor(provider)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(refundReq{RefundID: refundID, CorrelationID: correlationID, Amount: amount, RequestedAt: requestedAt})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/refunds", url), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req, sp := tracing.StartClient(req, "processor.refund", attribute.String("processor.provider", string(provider)))
+	resp, err := c.http.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("refund status: %d", resp.StatusCode)
+		}
+	}
+	tracing.End(sp, err)
+	return err
+}
+
 type HealthInfo struct {
 	Failing       bool `json:"failing"`
 	MinResponseMs int  `json:"minResponseTime"`
 }
 
 func (c *Client) Health(ctx context.Context, provider Provider) (HealthInfo, error) {
-	url := c.defaultURL
-	if provider == ProviderFallback {
-		url = c.fallbackURL
+	url, err := c.baseFor(provider)
+	if err != nil {
+		return HealthInfo{}, err
 	}
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/payments/service-health", url), nil)
 	resp, err := c.http.Do(req)
@@ -85,4 +140,40 @@ func (c *Client) Health(ctx context.Context, provider Provider) (HealthInfo, err
 		return HealthInfo{}, err
 	}
 	return out, nil
-}
\ No newline at end of file
+}
+
+// AdminSummaryInfo: o que o processor diz ter cobrado na janela.
+type AdminSummaryInfo struct {
+	TotalRequests     int64           `json:"totalRequests"`
+	TotalAmount       decimal.Decimal `json:"totalAmount"`
+	TotalFee          decimal.Decimal `json:"totalFee"`
+	FeePerTransaction decimal.Decimal `json:"feePerTransaction"`
+}
+
+// AdminSummary consulta GET {base}/admin/payments-summary?from=&to= do provider.
+func (c *Client) AdminSummary(ctx context.Context, provider Provider, from, to time.Time) (AdminSummaryInfo, error) {
+	base, err := c.baseFor(provider)
+	if err != nil {
+		return AdminSummaryInfo{}, err
+	}
+	q := url.Values{}
+	q.Set("from", from.UTC().Format(isoMillis))
+	q.Set("to", to.UTC().Format(isoMillis))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/admin/payments-summary?%s", base, q.Encode()), nil)
+	req.Header.Set("X-Rinha-Token", c.adminToken)
+	resp, err := c.admin.Do(req)
+	if err != nil {
+		return AdminSummaryInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return AdminSummaryInfo{}, fmt.Errorf("admin summary status: %d", resp.StatusCode)
+	}
+	var out AdminSummaryInfo
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return AdminSummaryInfo{}, err
+	}
+	return out, nil
+}
+
+const isoMillis = "2006-01-02T15:04:05.000Z"
@@ -0,0 +1,70 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// Spec descreve um payment processor configurado.
+type Spec struct {
+	Name     Provider
+	BaseURL  string
+	Priority int     // menor = preferido
+	Fee      float64 // fração do valor cobrada por transação (ex.: 0.05)
+	FeeFixed float64 // valor fixo cobrado por transação
+}
+
+// FeeFor estima o fee cobrado sobre um pagamento de valor amount.
+func (s Spec) FeeFor(amount decimal.Decimal) decimal.Decimal {
+	return amount.Mul(decimal.NewFromFloat(s.Fee)).Add(decimal.NewFromFloat(s.FeeFixed))
+}
+
+// FeeForTotal estima o fee de count pagamentos somando total.
+func (s Spec) FeeForTotal(count int64, total decimal.Decimal) decimal.Decimal {
+	return total.Mul(decimal.NewFromFloat(s.Fee)).Add(decimal.NewFromFloat(s.FeeFixed).Mul(decimal.NewFromInt(count)))
+}
+
+// Registry: conjunto de providers ordenado por prioridade.
+type Registry struct {
+	specs  []Spec
+	byName map[Provider]Spec
+}
+
+func NewRegistry(specs []Spec) (*Registry, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("registry: no providers configured")
+	}
+	r := &Registry{
+		specs:  append([]Spec(nil), specs...),
+		byName: make(map[Provider]Spec, len(specs)),
+	}
+	for _, s := range r.specs {
+		if s.Name == "" || s.BaseURL == "" {
+			return nil, fmt.Errorf("registry: provider requires name and url: %+v", s)
+		}
+		if _, dup := r.byName[s.Name]; dup {
+			return nil, fmt.Errorf("registry: duplicate provider %q", s.Name)
+		}
+		r.byName[s.Name] = s
+	}
+	sort.SliceStable(r.specs, func(i, j int) bool { return r.specs[i].Priority < r.specs[j].Priority })
+	return r, nil
+}
+
+// All devolve os providers em ordem de prioridade.
+func (r *Registry) All() []Spec { return r.specs }
+
+func (r *Registry) Names() []Provider {
+	out := make([]Provider, len(r.specs))
+	for i, s := range r.specs {
+		out[i] = s.Name
+	}
+	return out
+}
+
+func (r *Registry) Get(p Provider) (Spec, bool) {
+	s, ok := r.byName[p]
+	return s, ok
+}
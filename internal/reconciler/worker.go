@@ -2,46 +2,67 @@ package reconciler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/metrics"
 	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
 	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	maxProbeBatch    = 512             // cobre mais itens por ciclo
-	failAfter        = 5 * time.Second // falha cedo se realmente não apareceu
+	maxProbeBatch    = 512 // cobre mais itens por ciclo
 	probeHTTPTimeout = 500 * time.Millisecond
 	loopEvery        = 25 * time.Millisecond // mais responsivo
+	leaseSweepEvery  = time.Second
 )
 
+// Start: consulta o provider da última tentativa de cada item em voo. Se ele já
+// tiver o pagamento, marca PROCESSED (antes de um retry cobrar de novo). FAILED
+// por tentativas esgotadas é decisão do dispatcher (RetryPolicy). Também devolve
+// para PENDING os DISPATCHING com lease vencido (instância caiu no meio), para
+// qualquer instância saudável despachar de novo.
 func Start(ctx context.Context, db repo.DB, proc *processors.Client) {
 	go func() {
 		t := time.NewTicker(loopEvery)
 		defer t.Stop()
+		sweep := time.NewTicker(leaseSweepEvery)
+		defer sweep.Stop()
 		httpc := &http.Client{Timeout: probeHTTPTimeout}
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-sweep.C:
+				if n, err := db.ReleaseExpiredLeases(ctx); err != nil {
+					log.Printf("lease sweep err: %v", err)
+				} else if n > 0 {
+					log.Printf("lease sweep: %d payments back to PENDING", n)
+				}
 			case <-t.C:
-				ids, provs, times, err := db.ListInFlightWithTime(ctx, maxProbeBatch)
-				if err != nil || len(ids) == 0 {
+				items, err := db.ListInFlight(ctx, maxProbeBatch)
+				if err != nil || len(items) == 0 {
 					continue
 				}
-				now := time.Now()
-				for i, id := range ids {
-					pv := processors.Provider(provs[i])
-					if ok := probe(ctx, httpc, proc, pv, id); ok {
-						_ = db.MarkProcessed(ctx, id)
-						continue
+				for _, it := range items {
+					pv := processors.Provider(it.Provider)
+					// probe entra no trace do pagamento (traceparent gravado no intake)
+					ok := probe(tracing.FromTraceParent(ctx, it.TraceParent), httpc, proc, pv, it.CorrelationID)
+					if pv != "" {
+						metrics.ReconcilerProbe(string(pv), ok)
 					}
-					if now.Sub(times[i]) >= failAfter {
-						_ = db.MarkFailed(ctx, id)
+					if ok {
+						// ErrNotInFlight: o dispatcher finalizou no meio tempo
+						if err := db.MarkProcessed(ctx, it.CorrelationID); err != nil && !errors.Is(err, repo.ErrNotInFlight) {
+							log.Printf("reconciler mark processed %s: %v", it.CorrelationID, err)
+						}
 					}
 				}
 			}
@@ -50,19 +71,23 @@ func Start(ctx context.Context, db repo.DB, proc *processors.Client) {
 }
 
 func probe(ctx context.Context, httpc *http.Client, proc *processors.Client, pv processors.Provider, id uuid.UUID) bool {
-	base := procBaseURL(proc, pv)
+	base := proc.Base(pv)
+	if base == "" {
+		// ainda não despachado (ou provider fora do registry): nada a consultar
+		return false
+	}
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/payments/%s", base, id.String()), nil)
+	req, sp := tracing.StartClient(req, "reconciler.probe",
+		attribute.String("processor.provider", string(pv)),
+		attribute.String("payment.correlation_id", id.String()),
+	)
 	resp, err := httpc.Do(req)
 	if err != nil {
+		tracing.End(sp, err)
 		return false
 	}
 	defer resp.Body.Close()
+	sp.SetAttributes(attribute.Bool("payment.found", resp.StatusCode == 200))
+	sp.End()
 	return resp.StatusCode == 200
 }
-
-func procBaseURL(proc *processors.Client, pv processors.Provider) string {
-	if pv == processors.ProviderFallback {
-		return proc.FallbackBase()
-	}
-	return proc.DefaultBase()
-}
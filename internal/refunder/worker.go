@@ -0,0 +1,53 @@
+package refunder
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/josinaldojr/rinha-backend-2025/internal/processors"
+	"github.com/josinaldojr/rinha-backend-2025/internal/repo"
+	"github.com/josinaldojr/rinha-backend-2025/internal/retry"
+)
+
+const (
+	loopEvery       = 100 * time.Millisecond
+	batchSize       = 32
+	claimVisibility = 10 * time.Second // estorno reivindicado some da fila por esse tempo
+)
+
+// Start despacha os estornos PENDING para o provider do pagamento original.
+func Start(ctx context.Context, db repo.DB, proc *processors.Client, policy retry.Policy) {
+	go func() {
+		t := time.NewTicker(loopEvery)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				items, err := db.ClaimRefunds(ctx, claimVisibility, batchSize)
+				if err != nil || len(items) == 0 {
+					continue
+				}
+				for _, rf := range items {
+					refundOne(ctx, db, proc, policy, rf)
+				}
+			}
+		}
+	}()
+}
+
+func refundOne(ctx context.Context, db repo.DB, proc *processors.Client, policy retry.Policy, rf repo.Refund) {
+	err := proc.Refund(ctx, processors.Provider(rf.Provider), rf.ID, rf.CorrelationID, rf.Amount, rf.RequestedAt)
+	switch {
+	case err == nil:
+		_ = db.FinishRefund(ctx, rf.ID, repo.StatusProcessed, "", time.Now())
+	case policy.Exhausted(rf.Attempts):
+		log.Printf("refund %s (%s) failed after %d attempts: %v", rf.ID, rf.CorrelationID, rf.Attempts, err)
+		_ = db.FinishRefund(ctx, rf.ID, repo.StatusFailed, err.Error(), time.Now())
+	default:
+		_ = db.FinishRefund(ctx, rf.ID, repo.StatusPending, err.Error(), time.Now().Add(policy.Backoff(rf.Attempts)))
+	}
+}
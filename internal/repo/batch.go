@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Pagamento novo para inserção em lote
+type NewPayment struct {
+	CorrelationID uuid.UUID
+	Amount        decimal.Decimal
+	CallbackURL   string
+	TraceParent   string // W3C traceparent do intake (ver tracing.TraceParent)
+}
+
+// EnsureUniqueBatch: mesmo contrato do EnsureUnique, em um único INSERT multi-linha.
+// already[i] indica que items[i] já existia (inclusive repetido dentro do próprio lote).
+func (p *PgxDB) EnsureUniqueBatch(ctx context.Context, items []NewPayment) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(items))
+	amts := make([]string, len(items))
+	cbs := make([]string, len(items))
+	tps := make([]string, len(items))
+	for i, it := range items {
+		ids[i], amts[i], cbs[i], tps[i] = it.CorrelationID.String(), it.Amount.String(), it.CallbackURL, it.TraceParent
+	}
+	// WITH ORDINALITY + DISTINCT ON: a primeira ocorrência de um id no lote é a que conta
+	rows, err := p.pool.Query(ctx, `
+		INSERT INTO payments (correlation_id, amount, provider, status, requested_at, callback_url, trace_parent)
+		SELECT DISTINCT ON (t.cid) t.cid::uuid, t.amt::numeric, '', 'PENDING', now(), NULLIF(t.cb, ''), NULLIF(t.tp, '')
+		  FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) WITH ORDINALITY AS t(cid, amt, cb, tp, ord)
+		 ORDER BY t.cid, t.ord
+		ON CONFLICT (correlation_id) DO NOTHING
+		RETURNING correlation_id
+	`, ids, amts, cbs, tps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inserted := make(map[uuid.UUID]bool, len(items))
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		inserted[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return markAlready(items, inserted), nil
+}
+
+// markAlready: só a primeira ocorrência de um id inserido conta como nova.
+func markAlready(items []NewPayment, inserted map[uuid.UUID]bool) []bool {
+	already := make([]bool, len(items))
+	for i, it := range items {
+		if inserted[it.CorrelationID] {
+			delete(inserted, it.CorrelationID)
+			continue
+		}
+		already[i] = true
+	}
+	return already
+}
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Total de um (provider, status), de pagamentos ou de estornos
+type SummaryTotal struct {
+	Provider Provider
+	Status   Status
+	Refund   bool
+	Count    int64
+	Amount   decimal.Decimal
+}
+
+// SummaryBreakdown agrega pagamentos e estornos por provider e status em uma única
+// consulta (janela sobre requested_at de cada tabela). PROCESSED combina rollups e
+// bordas, como no Summary. Pagamentos ainda não despachados aparecem com ProviderUnassigned.
+func (p *PgxDB) SummaryBreakdown(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error) {
+	var args sqlArgs
+	processed := processedSource(&args, nil, from, to)
+	phFrom, phTo := args.add(from), args.add(to)
+	window := `(` + phFrom + `::timestamptz IS NULL OR requested_at >= ` + phFrom + `)
+		   AND (` + phTo + `::timestamptz IS NULL OR requested_at <= ` + phTo + `)`
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT provider, 'PROCESSED', false, sum(c)::bigint, sum(a)::text
+		  FROM (`+processed+`) s
+		 GROUP BY provider
+		UNION ALL
+		SELECT provider, status, false, count(*), sum(amount)::text
+		  FROM payments
+		 WHERE status IN ('PENDING', 'DISPATCHING', 'FAILED')
+		   AND `+window+`
+		 GROUP BY provider, status
+		UNION ALL
+		SELECT provider, status, true, count(*), sum(amount)::text
+		  FROM refunds
+		 WHERE `+window+`
+		 GROUP BY provider, status
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SummaryTotal
+	for rows.Next() {
+		var st SummaryTotal
+		var amt string
+		if err := rows.Scan(&st.Provider, &st.Status, &st.Refund, &st.Count, &amt); err != nil {
+			return nil, err
+		}
+		st.Amount, _ = decimal.NewFromString(amt)
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// SummaryProcessed: só os PROCESSED (pagamentos e estornos) por provider — o caminho
+// do /payments-summary sem includeStatuses. Pagamentos vêm de rollups + bordas da
+// janela; nenhum scan de PENDING/DISPATCHING/FAILED.
+func (p *PgxDB) SummaryProcessed(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error) {
+	q, args := summaryProcessedQuery(from, to)
+	rows, err := p.pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SummaryTotal
+	for rows.Next() {
+		st := SummaryTotal{Status: StatusProcessed}
+		var amt string
+		if err := rows.Scan(&st.Provider, &st.Refund, &st.Count, &amt); err != nil {
+			return nil, err
+		}
+		st.Amount, _ = decimal.NewFromString(amt)
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+func summaryProcessedQuery(from, to *time.Time) (string, sqlArgs) {
+	var args sqlArgs
+	processed := processedSource(&args, nil, from, to)
+	refunds := []string{"status = 'PROCESSED'"}
+	if from != nil {
+		refunds = append(refunds, "requested_at >= "+args.add(*from))
+	}
+	if to != nil {
+		refunds = append(refunds, "requested_at <= "+args.add(*to))
+	}
+	return `
+		SELECT provider, false, sum(c)::bigint, sum(a)::text
+		  FROM (` + processed + `) s
+		 GROUP BY provider
+		UNION ALL
+		SELECT provider, true, count(*), sum(amount)::text
+		  FROM refunds
+		 WHERE ` + strings.Join(refunds, " AND ") + `
+		 GROUP BY provider`, args
+}
+
+func (m *MemDB) SummaryProcessed(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error) {
+	all, err := m.SummaryBreakdown(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	out := all[:0]
+	for _, st := range all {
+		if st.Status == StatusProcessed {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemDB) SummaryBreakdown(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type key struct {
+		provider Provider
+		status   Status
+		refund   bool
+	}
+	agg := map[key]*SummaryTotal{}
+	add := func(k key, amount decimal.Decimal) {
+		st := agg[k]
+		if st == nil {
+			st = &SummaryTotal{Provider: k.provider, Status: k.status, Refund: k.refund, Amount: decimal.Zero}
+			agg[k] = st
+		}
+		st.Count++
+		st.Amount = st.Amount.Add(amount)
+	}
+	for _, r := range m.rows {
+		if inWindow(r.requestedAt, from, to) {
+			add(key{r.provider, r.status, false}, r.amount)
+		}
+	}
+	for _, rf := range m.refunds {
+		if inWindow(rf.RequestedAt, from, to) {
+			add(key{rf.Provider, rf.Status, true}, rf.Amount)
+		}
+	}
+
+	out := make([]SummaryTotal, 0, len(agg))
+	for _, st := range agg {
+		out = append(out, *st)
+	}
+	return out, nil
+}
@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
+	"github.com/shopspring/decimal"
+)
+
+// Teto de uma rodada de group-commit (independe do ctx de quem entrou primeiro)
+const coalesceFlushTimeout = time.Second
+
+type intakeReq struct {
+	item NewPayment
+	res  chan intakeRes
+}
+
+type intakeRes struct {
+	already bool
+	err     error
+}
+
+// coalescer: group-commit do EnsureUnique. Chamadas concorrentes dentro de `window`
+// viram um único EnsureUniqueBatch (INSERT multi-linha ... ON CONFLICT ... RETURNING)
+// e o resultado volta para cada handler que está esperando.
+type coalescer struct {
+	DB
+	window time.Duration
+	max    int
+
+	reqs     chan intakeReq
+	stop     chan struct{}
+	stopOnce sync.Once
+	flushes  sync.WaitGroup
+	done     chan struct{} // fechado após o loop drenar reqs e todos os flushes terminarem
+}
+
+// Coalesce embrulha db com o buffer de intake; window <= 0 devolve db sem mudança.
+func Coalesce(db DB, window time.Duration, max int) DB {
+	if window <= 0 {
+		return db
+	}
+	if max <= 0 {
+		max = 256
+	}
+	c := &coalescer{
+		DB:     db,
+		window: window,
+		max:    max,
+		reqs:   make(chan intakeReq, max),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+func (c *coalescer) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal, callbackURL string) (bool, error) {
+	req := intakeReq{
+		item: NewPayment{CorrelationID: correlationID, Amount: amount, CallbackURL: callbackURL, TraceParent: tracing.TraceParent(ctx)},
+		res:  make(chan intakeRes, 1),
+	}
+	select {
+	case c.reqs <- req:
+	case <-c.done:
+		return c.DB.EnsureUnique(ctx, correlationID, amount, callbackURL)
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	select {
+	case r := <-req.res:
+		return r.already, r.err
+	case <-c.done:
+		// loop encerrado: ou o pedido saiu no último flush (resposta já no canal),
+		// ou entrou no buffer depois da drenagem e vai direto
+		select {
+		case r := <-req.res:
+			return r.already, r.err
+		default:
+			return c.DB.EnsureUnique(ctx, correlationID, amount, callbackURL)
+		}
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Close encerra o loop, espera os flushes pendentes e só então fecha o DB.
+func (c *coalescer) Close(ctx context.Context) {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+	c.DB.Close(ctx)
+}
+
+// loop: a primeira chamada abre a janela; fecha por tempo ou ao atingir max.
+func (c *coalescer) loop() {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		var first intakeReq
+		select {
+		case first = <-c.reqs:
+		case <-c.stop:
+			c.drain()
+			return
+		}
+
+		batch := make([]intakeReq, 1, c.max)
+		batch[0] = first
+		timer.Reset(c.window)
+	collect:
+		for len(batch) < c.max {
+			select {
+			case req := <-c.reqs:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			case <-c.stop:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		// flush em paralelo: a próxima janela já pode abrir enquanto esta grava
+		c.flushes.Add(1)
+		go func() {
+			defer c.flushes.Done()
+			c.flush(batch)
+		}()
+	}
+}
+
+// drain grava o que ainda está no buffer, espera os flushes em andamento e fecha done.
+func (c *coalescer) drain() {
+	defer close(c.done)
+	var batch []intakeReq
+pending:
+	for {
+		select {
+		case req := <-c.reqs:
+			batch = append(batch, req)
+		default:
+			break pending
+		}
+	}
+	if len(batch) > 0 {
+		c.flush(batch)
+	}
+	c.flushes.Wait()
+}
+
+func (c *coalescer) flush(batch []intakeReq) {
+	ctx, cancel := context.WithTimeout(context.Background(), coalesceFlushTimeout)
+	defer cancel()
+
+	items := make([]NewPayment, len(batch))
+	for i, req := range batch {
+		items[i] = req.item
+	}
+	already, err := c.DB.EnsureUniqueBatch(ctx, items)
+	if err != nil && len(batch) > 1 {
+		// uma linha ruim não derruba as outras: refaz item a item, cada um com seu erro
+		for _, req := range batch {
+			a, err := c.DB.EnsureUnique(tracing.FromTraceParent(ctx, req.item.TraceParent),
+				req.item.CorrelationID, req.item.Amount, req.item.CallbackURL)
+			req.res <- intakeRes{already: a, err: err}
+		}
+		return
+	}
+	for i, req := range batch {
+		if err != nil {
+			req.res <- intakeRes{err: err}
+			continue
+		}
+		req.res <- intakeRes{already: already[i]}
+	}
+}
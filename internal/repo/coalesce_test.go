@@ -0,0 +1,195 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var errBadRow = errors.New("numeric field overflow")
+
+// batchSpy conta as chamadas de EnsureUniqueBatch que o coalescer faz; um item com
+// id bad falha o lote inteiro (como uma linha fora de numeric(18,2) no INSERT).
+type batchSpy struct {
+	*MemDB
+	mu    sync.Mutex
+	sizes []int
+	bad   uuid.UUID
+}
+
+func (s *batchSpy) EnsureUniqueBatch(ctx context.Context, items []NewPayment) ([]bool, error) {
+	s.mu.Lock()
+	s.sizes = append(s.sizes, len(items))
+	s.mu.Unlock()
+	for _, it := range items {
+		if it.CorrelationID == s.bad {
+			return nil, errBadRow
+		}
+	}
+	return s.MemDB.EnsureUniqueBatch(ctx, items)
+}
+
+func (s *batchSpy) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal, callbackURL string) (bool, error) {
+	if correlationID == s.bad {
+		return false, errBadRow
+	}
+	return s.MemDB.EnsureUnique(ctx, correlationID, amount, callbackURL)
+}
+
+func (s *batchSpy) batches() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.sizes...)
+}
+
+// intake dispara EnsureUnique concorrentes para ids e devolve already/err por posição.
+func intake(db DB, ids []uuid.UUID) ([]bool, []error) {
+	already := make([]bool, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			already[i], errs[i] = db.EnsureUnique(context.Background(), id, decimal.NewFromInt(1), "")
+		}()
+	}
+	wg.Wait()
+	return already, errs
+}
+
+func TestCoalesceGroupsConcurrentCalls(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB()}
+	db := Coalesce(spy, 50*time.Millisecond, 256)
+	defer db.Close(context.Background())
+
+	ids := make([]uuid.UUID, 20)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	already, errs := intake(db, ids)
+	for i := range ids {
+		if errs[i] != nil || already[i] {
+			t.Fatalf("call %d = %v, %v; want new payment", i, already[i], errs[i])
+		}
+	}
+	sizes := spy.batches()
+	total := 0
+	for _, n := range sizes {
+		total += n
+	}
+	if total != len(ids) || len(sizes) >= len(ids) {
+		t.Fatalf("batches = %v, want %d items grouped into fewer inserts", sizes, len(ids))
+	}
+	if pending, _, _ := spy.Backlog(context.Background()); pending != int64(len(ids)) {
+		t.Fatalf("pending = %d, want %d", pending, len(ids))
+	}
+}
+
+func TestCoalesceDuplicatesInOneWindow(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB()}
+	db := Coalesce(spy, 50*time.Millisecond, 256)
+	defer db.Close(context.Background())
+
+	dup := uuid.New()
+	already, errs := intake(db, []uuid.UUID{dup, dup, dup, uuid.New()})
+	fresh := 0
+	for i := range 3 {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if !already[i] {
+			fresh++
+		}
+	}
+	if fresh != 1 || already[3] {
+		t.Fatalf("already = %v, want exactly one new for the repeated id and the other id new", already)
+	}
+
+	// já existente, fora da janela anterior
+	if a, err := db.EnsureUnique(context.Background(), dup, decimal.NewFromInt(1), ""); err != nil || !a {
+		t.Fatalf("existing id = %v, %v; want already", a, err)
+	}
+}
+
+func TestCoalesceFlushesAtMax(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB()}
+	db := Coalesce(spy, time.Hour, 4) // só o tamanho fecha a janela
+	defer db.Close(context.Background())
+
+	ids := make([]uuid.UUID, 8)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	_, errs := intake(db, ids)
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range spy.batches() {
+		if n != 4 {
+			t.Fatalf("batches = %v, want full batches of 4", spy.batches())
+		}
+	}
+}
+
+func TestCoalesceIsolatesBadRow(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB(), bad: uuid.New()}
+	db := Coalesce(spy, 50*time.Millisecond, 256)
+	defer db.Close(context.Background())
+
+	ids := []uuid.UUID{uuid.New(), spy.bad, uuid.New(), uuid.New()}
+	already, errs := intake(db, ids)
+	for i, id := range ids {
+		if id == spy.bad {
+			if !errors.Is(errs[i], errBadRow) {
+				t.Fatalf("bad row err = %v, want %v", errs[i], errBadRow)
+			}
+			continue
+		}
+		if errs[i] != nil || already[i] {
+			t.Fatalf("call %d = %v, %v; want new payment despite the bad neighbour", i, already[i], errs[i])
+		}
+	}
+	if pending, _, _ := spy.Backlog(context.Background()); pending != 3 {
+		t.Fatalf("pending = %d, want the 3 good rows", pending)
+	}
+}
+
+func TestCoalesceCanceledCaller(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB()}
+	db := Coalesce(spy, time.Hour, 256)
+	defer db.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := db.EnsureUnique(ctx, uuid.New(), decimal.NewFromInt(1), ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the caller's deadline", err)
+	}
+}
+
+func TestCoalesceAfterCloseGoesDirect(t *testing.T) {
+	spy := &batchSpy{MemDB: NewMemDB()}
+	db := Coalesce(spy, time.Hour, 256)
+	db.Close(context.Background())
+
+	if a, err := db.EnsureUnique(context.Background(), uuid.New(), decimal.NewFromInt(1), ""); err != nil || a {
+		t.Fatalf("after Close = %v, %v; want direct insert", a, err)
+	}
+	if n := len(spy.batches()); n != 0 {
+		t.Fatalf("%d batch inserts after Close, want 0", n)
+	}
+}
+
+func TestCoalesceDisabled(t *testing.T) {
+	m := NewMemDB()
+	if db := Coalesce(m, 0, 256); db != DB(m) {
+		t.Fatalf("Coalesce with window 0 wrapped the DB")
+	}
+}
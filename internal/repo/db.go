@@ -3,21 +3,22 @@ package repo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
 	"github.com/shopspring/decimal"
 )
 
 // Tipos usados pelos handlers/decider
 type Provider string
 
-const (
-	ProviderDefault  Provider = "default"
-	ProviderFallback Provider = "fallback"
-)
+// ProviderUnassigned: placeholder de linhas ainda não despachadas.
+const ProviderUnassigned Provider = ""
 
 type Status string
 
@@ -28,41 +29,154 @@ const (
 	StatusFailed      Status = "FAILED"
 )
 
+// ErrNotFound: correlation_id desconhecido
+var ErrNotFound = errors.New("payment not found")
+
+// ErrLeaseLost: o claim deste owner não vale mais (lease expirou e a linha voltou
+// para a fila, ou outra instância já finalizou); a escrita foi descartada.
+var ErrLeaseLost = errors.New("payment lease lost")
+
+// ErrNotInFlight: o pagamento já não está PENDING/DISPATCHING; nada foi alterado.
+var ErrNotInFlight = errors.New("payment not in flight")
+
+// Situação atual de um pagamento (GET /payments/{correlationId})
+type Payment struct {
+	CorrelationID uuid.UUID
+	Amount        decimal.Decimal
+	Provider      Provider
+	Status        Status
+	RequestedAt   time.Time
+	Attempts      int
+	LastError     string
+}
+
 // Item de batch para o dispatcher
 type BatchItem struct {
 	ID            uuid.UUID
 	CorrelationID uuid.UUID
 	Amount        decimal.Decimal
+	Provider      Provider  // provider da tentativa anterior ("" na primeira)
+	RequestedAt   time.Time // requestedAt enviado na tentativa anterior
+	Attempts      int       // já contando a tentativa atual
+	Abandoned     bool      // o claim anterior expirou sem Finish (instância caiu no meio)
+	TraceParent   string    // trace do intake ("" sem tracing)
+}
+
+// Item em voo para o reconciler
+type InFlight struct {
+	CorrelationID uuid.UUID
+	Provider      Provider
+	Status        Status
+	RequestedAt   time.Time
+	TraceParent   string
+}
+
+// Pagamento FAILED na dead-letter (view payments_dead_letter)
+type DeadLetter struct {
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Amount        decimal.Decimal `json:"amount"`
+	Provider      Provider        `json:"provider"`
+	RequestedAt   time.Time       `json:"requestedAt"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError"`
+}
+
+// Estado compartilhado de um provider entre instâncias (tabela provider_state)
+type ProviderState struct {
+	Provider      Provider
+	Failing       bool
+	MinResponseMs int
+	HealthAt      *time.Time // nil = nunca consultado
+	Breaker       string
+	BreakerUntil  *time.Time
+	BreakerBy     string // instância que publicou o breaker
 }
 
 // Contrato usado nos handlers e workers
 type DB interface {
 	Close(ctx context.Context)
 
-	// Hot path (handler)
-	EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal) (already bool, err error)
+	// Hot path (handler); callbackURL vazio = sem webhook
+	EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal, callbackURL string) (already bool, err error)
+	// Intake em lote: um único INSERT; already[i] = items[i] já existia
+	EnsureUniqueBatch(ctx context.Context, items []NewPayment) (already []bool, err error)
 
-	// Finalização após chamada ao processor
-	Finish(ctx context.Context, correlationID uuid.UUID, provider Provider, status Status, requestedAt time.Time) error
+	// Finalização após chamada ao processor; só vale com o lease de owner ainda em pé (ErrLeaseLost)
+	Finish(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, status Status, requestedAt time.Time) error
+	// Devolve para PENDING, só reivindicável a partir de next (mesma regra de lease do Finish)
+	Retry(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, requestedAt, next time.Time, lastErr string) error
+	// Devolve o claim sem ter chamado processor: desconta a tentativa e mantém provider,
+	// requested_at e last_error (mesma regra de lease do Finish)
+	Release(ctx context.Context, correlationID uuid.UUID, owner string) error
+
+	// Consulta por correlation_id (ErrNotFound se não existir)
+	GetPayment(ctx context.Context, correlationID uuid.UUID) (Payment, error)
 
 	// Summary
 	Summary(ctx context.Context, provider Provider, from, to *time.Time) (count int64, total decimal.Decimal, err error)
+	// Pagamentos e estornos por provider e status, numa única consulta agrupada
+	SummaryBreakdown(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error)
+	// Só PROCESSED (pagamentos e estornos) por provider: rollups + bordas, sem os outros status
+	SummaryProcessed(ctx context.Context, from, to *time.Time) ([]SummaryTotal, error)
+	// Série temporal do summary, todos os providers numa consulta
+	SummarySeries(ctx context.Context, bucket Bucket, from, to *time.Time) ([]SeriesPoint, error)
 
 	// Health worker (advisory lock)
 	TryGlobalLock(ctx context.Context, key int64) (bool, error)
 	UnlockGlobal(ctx context.Context, key int64) error
 
-	// Dispatcher: pega lote PENDING -> marca como DISPATCHING e retorna os itens
-	ClaimPendingBatch(ctx context.Context, limit int) ([]BatchItem, error)
+	// Estado compartilhado do decider (health + breaker) entre instâncias
+	SaveHealth(ctx context.Context, provider Provider, failing bool, minResponseMs int) error
+	SaveBreaker(ctx context.Context, provider Provider, state string, until time.Time, instanceID string) error
+	LoadProviderStates(ctx context.Context) ([]ProviderState, error)
+
+	// Dispatcher: pega lote PENDING (com next_attempt_at vencido) -> marca como DISPATCHING
+	// com lease de owner até now+lease, incrementa attempts e retorna os itens
+	ClaimPendingBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]BatchItem, error)
+	// Contagem de PENDING/DISPATCHING (gauge de backlog)
+	Backlog(ctx context.Context) (pending, dispatching int64, err error)
+	// Devolve para PENDING os DISPATCHING com lease vencido
+	ReleaseExpiredLeases(ctx context.Context) (int64, error)
+	// Dispatcher: sinaliza quando novos pagamentos entram (LISTEN/NOTIFY)
+	Notifications(ctx context.Context) <-chan struct{}
 
 	// Reconciliação
-	ListInFlightWithTime(ctx context.Context, limit int) ([]uuid.UUID, []Provider, []time.Time, error)
+	ListInFlight(ctx context.Context, limit int) ([]InFlight, error)
+	// só PENDING/DISPATCHING (ErrNotInFlight)
 	MarkProcessed(ctx context.Context, id uuid.UUID) error
-	MarkFailed(ctx context.Context, id uuid.UUID) error
+	// provider vazio / requestedAt zero mantêm o que já está gravado; owner não vazio exige
+	// o lease (ErrLeaseLost), vazio aceita qualquer PENDING/DISPATCHING (ErrNotInFlight)
+	MarkFailed(ctx context.Context, id uuid.UUID, owner string, provider Provider, requestedAt time.Time, lastErr string) error
+
+	// Dead-letter: lista FAILED e devolve para PENDING (ids vazio = todos)
+	ListFailed(ctx context.Context, limit int) ([]DeadLetter, error)
+	Requeue(ctx context.Context, ids []uuid.UUID) (int64, error)
+
+	// Webhooks: entregas enfileiradas quando o pagamento chega em PROCESSED/FAILED
+	ClaimWebhooks(ctx context.Context, visibility time.Duration, limit int) ([]Webhook, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, status WebhookStatus, code int, lastErr string, next time.Time) error
+	ListWebhookDeliveries(ctx context.Context, correlationID uuid.UUID) ([]WebhookDelivery, error)
+
+	// Estornos
+	CreateRefund(ctx context.Context, refundID, correlationID uuid.UUID, amount *decimal.Decimal) (rf Refund, created bool, err error)
+	ClaimRefunds(ctx context.Context, visibility time.Duration, limit int) ([]Refund, error)
+	FinishRefund(ctx context.Context, id uuid.UUID, status Status, lastErr string, next time.Time) error
 }
 
 type PgxDB struct{ pool *pgxpool.Pool }
 
+// Connect escolhe a implementação pelo driver ("postgres" ou "memory").
+func Connect(ctx context.Context, driver, url string) (DB, error) {
+	switch driver {
+	case "memory":
+		return NewMemDB(), nil
+	case "", "postgres":
+		return Open(ctx, url)
+	default:
+		return nil, fmt.Errorf("unknown db driver: %q", driver)
+	}
+}
+
 // Open cria o pool (usado no main.go)
 func Open(ctx context.Context, url string) (*PgxDB, error) {
 	cfg, err := pgxpool.ParseConfig(url)
@@ -88,14 +202,15 @@ func Open(ctx context.Context, url string) (*PgxDB, error) {
 func (p *PgxDB) Close(ctx context.Context) { p.pool.Close() }
 
 // EnsureUnique: insere placeholder (PENDING) e detecta duplicidade por correlation_id.
-func (p *PgxDB) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal) (bool, error) {
+// O trigger payments_notify dispara pg_notify só quando a linha é de fato inserida.
+func (p *PgxDB) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal, callbackURL string) (bool, error) {
 	var dummy int
 	err := p.pool.QueryRow(ctx, `
-		INSERT INTO payments (correlation_id, amount, provider, status, requested_at)
-		VALUES ($1, $2, 'default', 'PENDING', now())
+		INSERT INTO payments (correlation_id, amount, provider, status, requested_at, callback_url, trace_parent)
+		VALUES ($1, $2, '', 'PENDING', now(), NULLIF($3, ''), NULLIF($4, ''))
 		ON CONFLICT (correlation_id) DO NOTHING
 		RETURNING 1
-	`, correlationID, amount).Scan(&dummy)
+	`, correlationID, amount, callbackURL, tracing.TraceParent(ctx)).Scan(&dummy)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -109,32 +224,76 @@ func (p *PgxDB) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amoun
 }
 
 // Finish: atualiza provider/status e requested_at com o timestamp usado no processor.
-func (p *PgxDB) Finish(ctx context.Context, correlationID uuid.UUID, provider Provider, status Status, requestedAt time.Time) error {
-	_, err := p.pool.Exec(ctx, `
+// Exige o lease de owner: quem perdeu o lease não sobrescreve o resultado de quem reassumiu.
+func (p *PgxDB) Finish(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, status Status, requestedAt time.Time) error {
+	tag, err := p.pool.Exec(ctx, `
 		UPDATE payments
-		   SET provider=$1, status=$2, requested_at=$4
+		   SET provider=$1, status=$2, requested_at=$4, lease_owner=NULL, lease_until=NULL
 		 WHERE correlation_id=$3
-	`, provider, status, correlationID, requestedAt)
-	return err
+		   AND status='DISPATCHING' AND lease_owner=$5
+	`, provider, status, correlationID, requestedAt, owner)
+	return affected(tag, err, ErrLeaseLost)
 }
 
-// Summary agrega contagem e soma por provider/status=PROCESSED, com filtros opcionais from/to.
-func (p *PgxDB) Summary(ctx context.Context, provider Provider, from, to *time.Time) (int64, decimal.Decimal, error) {
-	q := `SELECT count(*), COALESCE(sum(amount), 0) FROM payments WHERE provider=$1 AND status='PROCESSED'`
-	args := []any{provider}
-
-	if from != nil {
-		q += " AND requested_at >= $2"
-		args = append(args, *from)
-	}
-	if to != nil {
-		if from != nil {
-			q += " AND requested_at <= $3"
-		} else {
-			q += " AND requested_at <= $2"
+// Retry: volta para PENDING com agendamento e o erro da tentativa (mesma regra de lease).
+func (p *PgxDB) Retry(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, requestedAt, next time.Time, lastErr string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE payments
+		   SET provider=$2, status='PENDING', requested_at=$3, next_attempt_at=$4, last_error=$5
+		     , lease_owner=NULL, lease_until=NULL
+		 WHERE correlation_id=$1
+		   AND status='DISPATCHING' AND lease_owner=$6
+	`, correlationID, provider, requestedAt, next, lastErr, owner)
+	return affected(tag, err, ErrLeaseLost)
+}
+
+// Release: o item nem chegou ao processor (sem vaga de provider); não conta tentativa.
+func (p *PgxDB) Release(ctx context.Context, correlationID uuid.UUID, owner string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE payments
+		   SET status='PENDING', attempts=attempts-1, next_attempt_at=now()
+		     , lease_owner=NULL, lease_until=NULL
+		 WHERE correlation_id=$1
+		   AND status='DISPATCHING' AND lease_owner=$2
+	`, correlationID, owner)
+	return affected(tag, err, ErrLeaseLost)
+}
+
+// affected: UPDATE que não pegou linha nenhuma vira none.
+func affected(tag pgconn.CommandTag, err error, none error) error {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return none
+	}
+	return nil
+}
+
+func (p *PgxDB) GetPayment(ctx context.Context, correlationID uuid.UUID) (Payment, error) {
+	var pm Payment
+	var amtStr string
+	err := p.pool.QueryRow(ctx, `
+		SELECT correlation_id, amount, provider, status, requested_at, attempts, COALESCE(last_error, '')
+		  FROM payments
+		 WHERE correlation_id=$1
+	`, correlationID).Scan(&pm.CorrelationID, &amtStr, &pm.Provider, &pm.Status, &pm.RequestedAt, &pm.Attempts, &pm.LastError)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Payment{}, ErrNotFound
 		}
-		args = append(args, *to)
+		return Payment{}, err
 	}
+	pm.Amount, _ = decimal.NewFromString(amtStr)
+	return pm, nil
+}
+
+// Summary agrega contagem e soma por provider/status=PROCESSED, com filtros opcionais from/to.
+// Buckets inteiros vêm de payment_rollups; só as bordas da janela varrem payments.
+func (p *PgxDB) Summary(ctx context.Context, provider Provider, from, to *time.Time) (int64, decimal.Decimal, error) {
+	var args sqlArgs
+	q := `SELECT COALESCE(sum(c), 0)::bigint, COALESCE(sum(a), 0)::text FROM (` +
+		processedSource(&args, &provider, from, to) + `) s`
 
 	var count int64
 	var totalStr string
@@ -145,6 +304,16 @@ func (p *PgxDB) Summary(ctx context.Context, provider Provider, from, to *time.T
 	return count, total, nil
 }
 
+func (p *PgxDB) Backlog(ctx context.Context) (int64, int64, error) {
+	var pending, dispatching int64
+	err := p.pool.QueryRow(ctx, `
+		SELECT count(*) FILTER (WHERE status='PENDING'), count(*) FILTER (WHERE status='DISPATCHING')
+		  FROM payments
+		 WHERE status IN ('PENDING', 'DISPATCHING')
+	`).Scan(&pending, &dispatching)
+	return pending, dispatching, err
+}
+
 // Advisory lock para o health worker
 func (p *PgxDB) TryGlobalLock(ctx context.Context, key int64) (bool, error) {
 	var ok bool
@@ -157,29 +326,77 @@ func (p *PgxDB) UnlockGlobal(ctx context.Context, key int64) error {
 	return p.pool.QueryRow(ctx, `SELECT pg_advisory_unlock($1)`, key).Scan(&ok)
 }
 
-// ClaimPendingBatch: bloqueia e marca PENDING -> DISPATCHING em um único statement.
-// Retorna o lote para processamento fora da transação (sem segurar lock).
-func (p *PgxDB) ClaimPendingBatch(ctx context.Context, limit int) ([]BatchItem, error) {
+func (p *PgxDB) SaveHealth(ctx context.Context, provider Provider, failing bool, minResponseMs int) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO provider_state (provider, failing, min_response_ms, health_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (provider) DO UPDATE
+		   SET failing = EXCLUDED.failing
+		     , min_response_ms = EXCLUDED.min_response_ms
+		     , health_at = EXCLUDED.health_at
+	`, provider, failing, minResponseMs)
+	return err
+}
+
+func (p *PgxDB) SaveBreaker(ctx context.Context, provider Provider, state string, until time.Time, instanceID string) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO provider_state (provider, breaker, breaker_until, breaker_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider) DO UPDATE
+		   SET breaker = EXCLUDED.breaker
+		     , breaker_until = EXCLUDED.breaker_until
+		     , breaker_by = EXCLUDED.breaker_by
+	`, provider, state, until, instanceID)
+	return err
+}
+
+func (p *PgxDB) LoadProviderStates(ctx context.Context) ([]ProviderState, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT provider, failing, min_response_ms, health_at, breaker, breaker_until, breaker_by
+		  FROM provider_state
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ProviderState
+	for rows.Next() {
+		var s ProviderState
+		if err := rows.Scan(&s.Provider, &s.Failing, &s.MinResponseMs, &s.HealthAt, &s.Breaker, &s.BreakerUntil, &s.BreakerBy); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ClaimPendingBatch: bloqueia e marca PENDING -> DISPATCHING em um único statement,
+// respeitando next_attempt_at, contando a tentativa e gravando o lease. Retorna o
+// lote para processamento fora da transação (sem segurar lock).
+// lease_owner só sobrevive a um claim se ele expirou sem Finish: vira Abandoned.
+func (p *PgxDB) ClaimPendingBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]BatchItem, error) {
 	rows, err := p.pool.Query(ctx, `
 		WITH cte AS (
 		  SELECT id
-		       , correlation_id
-		       , amount
+		       , lease_owner IS NOT NULL AS abandoned
 		    FROM payments
 		   WHERE status = 'PENDING'
-		   ORDER BY requested_at
+		     AND next_attempt_at <= now()
+		   ORDER BY next_attempt_at
 		   FOR UPDATE SKIP LOCKED
 		   LIMIT $1
-		),
-		upd AS (
-		  UPDATE payments p
-		     SET status = 'DISPATCHING'
-		    FROM cte
-		   WHERE p.id = cte.id
 		)
-		SELECT cte.id, cte.correlation_id, cte.amount
+		UPDATE payments p
+		   SET status = 'DISPATCHING'
+		     , attempts = p.attempts + 1
+		     , lease_owner = $2
+		     , lease_until = now() + $3::float8 * interval '1 millisecond'
 		  FROM cte
-	`, limit)
+		 WHERE p.id = cte.id
+		RETURNING p.id, p.correlation_id, p.amount, p.provider, p.requested_at, p.attempts, cte.abandoned
+		        , COALESCE(p.trace_parent, '')
+	`, limit, owner, lease.Milliseconds())
 	if err != nil {
 		return nil, err
 	}
@@ -187,54 +404,136 @@ func (p *PgxDB) ClaimPendingBatch(ctx context.Context, limit int) ([]BatchItem,
 
 	var out []BatchItem
 	for rows.Next() {
-		var id, cid uuid.UUID
+		var it BatchItem
 		var amtStr string
-		if err := rows.Scan(&id, &cid, &amtStr); err != nil {
+		if err := rows.Scan(&it.ID, &it.CorrelationID, &amtStr, &it.Provider, &it.RequestedAt, &it.Attempts, &it.Abandoned, &it.TraceParent); err != nil {
 			return nil, err
 		}
-		amt, _ := decimal.NewFromString(amtStr)
-		out = append(out, BatchItem{ID: id, CorrelationID: cid, Amount: amt})
+		it.Amount, _ = decimal.NewFromString(amtStr)
+		out = append(out, it)
 	}
 	return out, rows.Err()
 }
 
+// ReleaseExpiredLeases: DISPATCHING com lease vencido volta para PENDING. lease_owner
+// é mantido de propósito para o próximo claim saber que a tentativa foi abandonada.
+func (p *PgxDB) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE payments
+		   SET status='PENDING', next_attempt_at=now(), lease_until=NULL
+		     , last_error='lease expired (owner ' || lease_owner || ')'
+		 WHERE status='DISPATCHING'
+		   AND lease_until < now()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		_, _ = p.pool.Exec(ctx, `SELECT pg_notify($1, '')`, notifyChannel)
+	}
+	return tag.RowsAffected(), nil
+}
+
 // Reconciliação: busca itens em voo (PENDING e DISPATCHING) do mais antigo.
-func (p *PgxDB) ListInFlightWithTime(ctx context.Context, limit int) ([]uuid.UUID, []Provider, []time.Time, error) {
+func (p *PgxDB) ListInFlight(ctx context.Context, limit int) ([]InFlight, error) {
 	rows, err := p.pool.Query(ctx, `
-		SELECT correlation_id, provider, requested_at
+		SELECT correlation_id, provider, status, requested_at, COALESCE(trace_parent, '')
 		  FROM payments
 		 WHERE status IN ('PENDING','DISPATCHING')
 		 ORDER BY requested_at ASC
 		 LIMIT $1
 	`, limit)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var ids []uuid.UUID
-	var provs []Provider
-	var times []time.Time
+	var out []InFlight
 	for rows.Next() {
-		var id uuid.UUID
-		var pv Provider
-		var ts time.Time
-		if err := rows.Scan(&id, &pv, &ts); err != nil {
-			return nil, nil, nil, err
+		var it InFlight
+		if err := rows.Scan(&it.CorrelationID, &it.Provider, &it.Status, &it.RequestedAt, &it.TraceParent); err != nil {
+			return nil, err
 		}
-		ids, provs, times = append(ids, id), append(provs, pv), append(times, ts)
+		out = append(out, it)
 	}
-	return ids, provs, times, rows.Err()
+	return out, rows.Err()
 }
 
 func (p *PgxDB) MarkProcessed(ctx context.Context, id uuid.UUID) error {
-	_, err := p.pool.Exec(ctx, `UPDATE payments SET status='PROCESSED' WHERE correlation_id=$1`, id)
-	return err
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE payments
+		   SET status='PROCESSED', lease_owner=NULL, lease_until=NULL
+		 WHERE correlation_id=$1
+		   AND status IN ('PENDING','DISPATCHING')
+	`, id)
+	return affected(tag, err, ErrNotInFlight)
 }
 
-func (p *PgxDB) MarkFailed(ctx context.Context, id uuid.UUID) error {
-	_, err := p.pool.Exec(ctx, `UPDATE payments SET status='FAILED' WHERE correlation_id=$1`, id)
-	return err
+// MarkFailed grava também o requestedAt da última tentativa: um Requeue posterior
+// confirma nesse provider e fecha com esse timestamp, o mesmo que o processor registrou.
+func (p *PgxDB) MarkFailed(ctx context.Context, id uuid.UUID, owner string, provider Provider, requestedAt time.Time, lastErr string) error {
+	var at *time.Time
+	if !requestedAt.IsZero() {
+		at = &requestedAt
+	}
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE payments
+		   SET status='FAILED', provider=COALESCE(NULLIF($2, ''), provider), last_error=$3
+		     , requested_at=COALESCE($5, requested_at)
+		     , lease_owner=NULL, lease_until=NULL
+		 WHERE correlation_id=$1
+		   AND CASE WHEN $4 = '' THEN status IN ('PENDING','DISPATCHING')
+		            ELSE status = 'DISPATCHING' AND lease_owner = $4 END
+	`, id, provider, lastErr, owner, at)
+	if owner != "" {
+		return affected(tag, err, ErrLeaseLost)
+	}
+	return affected(tag, err, ErrNotInFlight)
+}
+
+func (p *PgxDB) ListFailed(ctx context.Context, limit int) ([]DeadLetter, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT correlation_id, amount, provider, requested_at, attempts, last_error
+		  FROM payments_dead_letter
+		 ORDER BY requested_at
+		 LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		var amtStr string
+		if err := rows.Scan(&dl.CorrelationID, &amtStr, &dl.Provider, &dl.RequestedAt, &dl.Attempts, &dl.LastError); err != nil {
+			return nil, err
+		}
+		dl.Amount, _ = decimal.NewFromString(amtStr)
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// Requeue: FAILED -> PENDING com tentativas zeradas. O provider é mantido para o
+// dispatcher confirmar lá antes de pagar de novo.
+func (p *PgxDB) Requeue(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	q := `UPDATE payments SET status='PENDING', attempts=0, next_attempt_at=now() WHERE status='FAILED'`
+	var args []any
+	if len(ids) > 0 {
+		q += ` AND correlation_id = ANY($1)`
+		args = append(args, ids)
+	}
+	tag, err := p.pool.Exec(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		// UPDATE não passa pelo trigger de insert: acorda o dispatcher na mão
+		_, _ = p.pool.Exec(ctx, `SELECT pg_notify($1, '')`, notifyChannel)
+	}
+	return tag.RowsAffected(), nil
 }
 
 // ParseISO: helper para parsear timestamps ISO UTC do /payments-summary?from&to
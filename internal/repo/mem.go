@@ -0,0 +1,630 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/josinaldojr/rinha-backend-2025/internal/tracing"
+	"github.com/shopspring/decimal"
+)
+
+// MemDB: implementação em memória do DB, para testes e execução sem Postgres.
+// Mantém a mesma máquina de estados (PENDING -> DISPATCHING -> PROCESSED/FAILED).
+type MemDB struct {
+	mu    sync.Mutex
+	rows  map[uuid.UUID]*memRow // por correlation_id
+	locks map[int64]bool        // emulação de advisory lock
+	provs map[Provider]*ProviderState
+	subs  []chan struct{}
+
+	webhooks    []*memWebhook
+	nextWebhook int64
+
+	refunds []*memRefund // em ordem de criação
+}
+
+type memRow struct {
+	id            uuid.UUID
+	correlationID uuid.UUID
+	amount        decimal.Decimal
+	provider      Provider
+	status        Status
+	requestedAt   time.Time
+	attempts      int
+	nextAttemptAt time.Time
+	lastError     string
+	leaseOwner    string
+	leaseUntil    time.Time
+	callbackURL   string
+	traceParent   string
+}
+
+type memRefund struct {
+	Refund
+	nextAttemptAt time.Time
+}
+
+type memWebhook struct {
+	WebhookDelivery
+	nextAttemptAt time.Time
+}
+
+// clearLease: chamado em toda finalização (equivale a lease_owner/lease_until = NULL).
+func (r *memRow) clearLease() {
+	r.leaseOwner, r.leaseUntil = "", time.Time{}
+}
+
+func NewMemDB() *MemDB {
+	return &MemDB{
+		rows:  make(map[uuid.UUID]*memRow),
+		locks: make(map[int64]bool),
+		provs: make(map[Provider]*ProviderState),
+	}
+}
+
+func (m *MemDB) Close(ctx context.Context) {}
+
+func (m *MemDB) EnsureUnique(ctx context.Context, correlationID uuid.UUID, amount decimal.Decimal, callbackURL string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.rows[correlationID]; ok {
+		return true, nil
+	}
+	now := time.Now().UTC()
+	m.rows[correlationID] = &memRow{
+		id:            uuid.New(),
+		correlationID: correlationID,
+		amount:        amount,
+		provider:      ProviderUnassigned,
+		status:        StatusPending,
+		requestedAt:   now,
+		nextAttemptAt: now,
+		callbackURL:   callbackURL,
+		traceParent:   tracing.TraceParent(ctx),
+	}
+	m.notifyLocked()
+	return false, nil
+}
+
+func (m *MemDB) EnsureUniqueBatch(ctx context.Context, items []NewPayment) ([]bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	already := make([]bool, len(items))
+	for i, it := range items {
+		if _, ok := m.rows[it.CorrelationID]; ok {
+			already[i] = true
+			continue
+		}
+		m.rows[it.CorrelationID] = &memRow{
+			id:            uuid.New(),
+			correlationID: it.CorrelationID,
+			amount:        it.Amount,
+			provider:      ProviderUnassigned,
+			status:        StatusPending,
+			requestedAt:   now,
+			nextAttemptAt: now,
+			callbackURL:   it.CallbackURL,
+			traceParent:   it.TraceParent,
+		}
+	}
+	m.notifyLocked()
+	return already, nil
+}
+
+func (m *MemDB) Notifications(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	m.mu.Lock()
+	m.subs = append(m.subs, ch)
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, c := range m.subs {
+			if c == ch {
+				m.subs = append(m.subs[:i], m.subs[i+1:]...)
+				break
+			}
+		}
+	}()
+	return ch
+}
+
+// notifyLocked: equivalente ao trigger de NOTIFY. Exige m.mu.
+func (m *MemDB) notifyLocked() {
+	for _, ch := range m.subs {
+		signal(ch)
+	}
+}
+
+// leasedLocked: a linha ainda está DISPATCHING sob o lease de owner. Exige m.mu.
+func (m *MemDB) leasedLocked(id uuid.UUID, owner string) (*memRow, bool) {
+	r, ok := m.rows[id]
+	if !ok || r.status != StatusDispatching || r.leaseOwner != owner {
+		return nil, false
+	}
+	return r, true
+}
+
+func (m *MemDB) Finish(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, status Status, requestedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.leasedLocked(correlationID, owner)
+	if !ok {
+		return ErrLeaseLost
+	}
+	old := r.status
+	r.provider = provider
+	r.status = status
+	r.requestedAt = requestedAt
+	r.clearLease()
+	m.statusChangedLocked(r, old)
+	return nil
+}
+
+func (m *MemDB) Retry(ctx context.Context, correlationID uuid.UUID, owner string, provider Provider, requestedAt, next time.Time, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.leasedLocked(correlationID, owner)
+	if !ok {
+		return ErrLeaseLost
+	}
+	r.provider = provider
+	r.status = StatusPending
+	r.requestedAt = requestedAt
+	r.nextAttemptAt = next
+	r.lastError = lastErr
+	r.clearLease()
+	return nil
+}
+
+func (m *MemDB) Release(ctx context.Context, correlationID uuid.UUID, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.leasedLocked(correlationID, owner)
+	if !ok {
+		return ErrLeaseLost
+	}
+	r.status = StatusPending
+	r.attempts--
+	r.nextAttemptAt = time.Now()
+	r.clearLease()
+	return nil
+}
+
+func (m *MemDB) GetPayment(ctx context.Context, correlationID uuid.UUID) (Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rows[correlationID]
+	if !ok {
+		return Payment{}, ErrNotFound
+	}
+	return Payment{
+		CorrelationID: r.correlationID,
+		Amount:        r.amount,
+		Provider:      r.provider,
+		Status:        r.status,
+		RequestedAt:   r.requestedAt,
+		Attempts:      r.attempts,
+		LastError:     r.lastError,
+	}, nil
+}
+
+// Summary: sem payment_rollups aqui; o scan em memória já é o caminho barato.
+func (m *MemDB) Summary(ctx context.Context, provider Provider, from, to *time.Time) (int64, decimal.Decimal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	total := decimal.Zero
+	for _, r := range m.rows {
+		if r.provider != provider || r.status != StatusProcessed || !inWindow(r.requestedAt, from, to) {
+			continue
+		}
+		count++
+		total = total.Add(r.amount)
+	}
+	return count, total, nil
+}
+
+func (m *MemDB) Backlog(ctx context.Context) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending, dispatching int64
+	for _, r := range m.rows {
+		switch r.status {
+		case StatusPending:
+			pending++
+		case StatusDispatching:
+			dispatching++
+		}
+	}
+	return pending, dispatching, nil
+}
+
+func (m *MemDB) TryGlobalLock(ctx context.Context, key int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locks[key] {
+		return false, nil
+	}
+	m.locks[key] = true
+	return true, nil
+}
+
+func (m *MemDB) UnlockGlobal(ctx context.Context, key int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.locks, key)
+	return nil
+}
+
+func (m *MemDB) SaveHealth(ctx context.Context, provider Provider, failing bool, minResponseMs int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.providerLocked(provider)
+	now := time.Now()
+	s.Failing, s.MinResponseMs, s.HealthAt = failing, minResponseMs, &now
+	return nil
+}
+
+func (m *MemDB) SaveBreaker(ctx context.Context, provider Provider, state string, until time.Time, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.providerLocked(provider)
+	s.Breaker, s.BreakerUntil, s.BreakerBy = state, &until, instanceID
+	return nil
+}
+
+func (m *MemDB) LoadProviderStates(ctx context.Context) ([]ProviderState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]ProviderState, 0, len(m.provs))
+	for _, s := range m.provs {
+		out = append(out, *s)
+	}
+	return out, nil
+}
+
+func (m *MemDB) providerLocked(p Provider) *ProviderState {
+	s, ok := m.provs[p]
+	if !ok {
+		s = &ProviderState{Provider: p, Breaker: "closed"}
+		m.provs[p] = s
+	}
+	return s
+}
+
+// ClaimPendingBatch: equivalente ao FOR UPDATE SKIP LOCKED — o mutex garante
+// que cada linha PENDING é entregue a um único chamador.
+func (m *MemDB) ClaimPendingBatch(ctx context.Context, owner string, lease time.Duration, limit int) ([]BatchItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	pending := m.selectLocked(func(r *memRow) bool {
+		return r.status == StatusPending && !r.nextAttemptAt.After(now)
+	}, func(r *memRow) time.Time { return r.nextAttemptAt }, limit)
+	out := make([]BatchItem, 0, len(pending))
+	for _, r := range pending {
+		abandoned := r.leaseOwner != ""
+		r.status = StatusDispatching
+		r.attempts++
+		r.leaseOwner, r.leaseUntil = owner, now.Add(lease)
+		out = append(out, BatchItem{
+			ID:            r.id,
+			CorrelationID: r.correlationID,
+			Amount:        r.amount,
+			Provider:      r.provider,
+			RequestedAt:   r.requestedAt,
+			Attempts:      r.attempts,
+			Abandoned:     abandoned,
+			TraceParent:   r.traceParent,
+		})
+	}
+	return out, nil
+}
+
+// ReleaseExpiredLeases: mantém leaseOwner como marca de tentativa abandonada.
+func (m *MemDB) ReleaseExpiredLeases(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var n int64
+	for _, r := range m.rows {
+		if r.status == StatusDispatching && r.leaseUntil.Before(now) {
+			r.status, r.nextAttemptAt, r.leaseUntil = StatusPending, now, time.Time{}
+			r.lastError = "lease expired (owner " + r.leaseOwner + ")"
+			n++
+		}
+	}
+	if n > 0 {
+		m.notifyLocked()
+	}
+	return n, nil
+}
+
+func (m *MemDB) ListInFlight(ctx context.Context, limit int) ([]InFlight, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rows := m.selectLocked(func(r *memRow) bool {
+		return r.status == StatusPending || r.status == StatusDispatching
+	}, byRequestedAt, limit)
+	out := make([]InFlight, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, InFlight{CorrelationID: r.correlationID, Provider: r.provider, Status: r.status, RequestedAt: r.requestedAt, TraceParent: r.traceParent})
+	}
+	return out, nil
+}
+
+func (m *MemDB) MarkProcessed(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rows[id]
+	if !ok || (r.status != StatusPending && r.status != StatusDispatching) {
+		return ErrNotInFlight
+	}
+	old := r.status
+	r.status = StatusProcessed
+	r.clearLease()
+	m.statusChangedLocked(r, old)
+	return nil
+}
+
+func (m *MemDB) MarkFailed(ctx context.Context, id uuid.UUID, owner string, provider Provider, requestedAt time.Time, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var r *memRow
+	if owner != "" {
+		var ok bool
+		if r, ok = m.leasedLocked(id, owner); !ok {
+			return ErrLeaseLost
+		}
+	} else if r = m.rows[id]; r == nil || (r.status != StatusPending && r.status != StatusDispatching) {
+		return ErrNotInFlight
+	}
+	old := r.status
+	r.status = StatusFailed
+	if provider != ProviderUnassigned {
+		r.provider = provider
+	}
+	if !requestedAt.IsZero() {
+		r.requestedAt = requestedAt
+	}
+	r.lastError = lastErr
+	r.clearLease()
+	m.statusChangedLocked(r, old)
+	return nil
+}
+
+func (m *MemDB) ListFailed(ctx context.Context, limit int) ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rows := m.selectLocked(func(r *memRow) bool { return r.status == StatusFailed }, byRequestedAt, limit)
+	out := make([]DeadLetter, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, DeadLetter{
+			CorrelationID: r.correlationID,
+			Amount:        r.amount,
+			Provider:      r.provider,
+			RequestedAt:   r.requestedAt,
+			Attempts:      r.attempts,
+			LastError:     r.lastError,
+		})
+	}
+	return out, nil
+}
+
+func (m *MemDB) Requeue(ctx context.Context, ids []uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var n int64
+	requeue := func(r *memRow) {
+		if r.status != StatusFailed {
+			return
+		}
+		r.status, r.attempts, r.nextAttemptAt = StatusPending, 0, now
+		n++
+	}
+	if len(ids) == 0 {
+		for _, r := range m.rows {
+			requeue(r)
+		}
+	} else {
+		for _, id := range ids {
+			if r, ok := m.rows[id]; ok {
+				requeue(r)
+			}
+		}
+	}
+	if n > 0 {
+		m.notifyLocked()
+	}
+	return n, nil
+}
+
+func byRequestedAt(r *memRow) time.Time { return r.requestedAt }
+
+// selectLocked: filtra e ordena pela chave (ORDER BY ... LIMIT). Exige m.mu.
+func (m *MemDB) selectLocked(match func(*memRow) bool, key func(*memRow) time.Time, limit int) []*memRow {
+	var out []*memRow
+	for _, r := range m.rows {
+		if match(r) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return key(out[i]).Before(key(out[j])) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// statusChangedLocked: equivalente ao trigger payments_enqueue_webhook. Exige m.mu.
+func (m *MemDB) statusChangedLocked(r *memRow, old Status) {
+	if r.callbackURL == "" || r.status == old || (r.status != StatusProcessed && r.status != StatusFailed) {
+		return
+	}
+	m.nextWebhook++
+	now := time.Now()
+	m.webhooks = append(m.webhooks, &memWebhook{
+		WebhookDelivery: WebhookDelivery{
+			ID:            m.nextWebhook,
+			CorrelationID: r.correlationID,
+			URL:           r.callbackURL,
+			Event:         r.status,
+			Status:        WebhookPending,
+			CreatedAt:     now,
+		},
+		nextAttemptAt: now,
+	})
+}
+
+func (m *MemDB) ClaimWebhooks(ctx context.Context, visibility time.Duration, limit int) ([]Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var out []Webhook
+	for _, w := range m.webhooks { // já em ordem de criação
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if w.Status != WebhookPending || w.nextAttemptAt.After(now) {
+			continue
+		}
+		w.Attempts++
+		w.nextAttemptAt = now.Add(visibility)
+		r := m.rows[w.CorrelationID]
+		out = append(out, Webhook{
+			ID:            w.ID,
+			CorrelationID: w.CorrelationID,
+			URL:           w.URL,
+			Event:         w.Event,
+			Amount:        r.amount,
+			Provider:      r.provider,
+			RequestedAt:   r.requestedAt,
+			LastError:     r.lastError,
+			Attempts:      w.Attempts,
+		})
+	}
+	return out, nil
+}
+
+func (m *MemDB) RecordWebhookAttempt(ctx context.Context, id int64, status WebhookStatus, code int, lastErr string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, w := range m.webhooks {
+		if w.ID != id {
+			continue
+		}
+		w.Status, w.LastCode, w.LastError, w.nextAttemptAt = status, code, lastErr, next
+		if status == WebhookDelivered {
+			now := time.Now()
+			w.DeliveredAt = &now
+		}
+		break
+	}
+	return nil
+}
+
+func (m *MemDB) ListWebhookDeliveries(ctx context.Context, correlationID uuid.UUID) ([]WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []WebhookDelivery
+	for _, w := range m.webhooks {
+		if w.CorrelationID == correlationID {
+			out = append(out, w.WebhookDelivery)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemDB) CreateRefund(ctx context.Context, refundID, correlationID uuid.UUID, amount *decimal.Decimal) (Refund, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refunded := decimal.Zero
+	for _, rf := range m.refunds {
+		if rf.ID == refundID {
+			if rf.CorrelationID != correlationID {
+				return Refund{}, false, ErrRefundIDConflict
+			}
+			return rf.Refund, false, nil
+		}
+		if rf.CorrelationID == correlationID && rf.Status != StatusFailed {
+			refunded = refunded.Add(rf.Amount)
+		}
+	}
+	r, ok := m.rows[correlationID]
+	if !ok {
+		return Refund{}, false, ErrNotFound
+	}
+	if r.status != StatusProcessed {
+		return Refund{}, false, ErrNotRefundable
+	}
+	remaining := r.amount.Sub(refunded)
+	amt := remaining
+	if amount != nil {
+		amt = *amount
+	}
+	if !amt.IsPositive() || amt.GreaterThan(remaining) {
+		return Refund{}, false, ErrRefundExceeds
+	}
+	now := time.Now().UTC()
+	rf := &memRefund{
+		Refund: Refund{
+			ID:            refundID,
+			CorrelationID: correlationID,
+			Provider:      r.provider,
+			Amount:        amt,
+			Status:        StatusPending,
+			RequestedAt:   now,
+		},
+		nextAttemptAt: now,
+	}
+	m.refunds = append(m.refunds, rf)
+	return rf.Refund, true, nil
+}
+
+func (m *MemDB) ClaimRefunds(ctx context.Context, visibility time.Duration, limit int) ([]Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var out []Refund
+	for _, rf := range m.refunds {
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		if rf.Status != StatusPending || rf.nextAttemptAt.After(now) {
+			continue
+		}
+		rf.Attempts++
+		rf.nextAttemptAt = now.Add(visibility)
+		out = append(out, rf.Refund)
+	}
+	return out, nil
+}
+
+func (m *MemDB) FinishRefund(ctx context.Context, id uuid.UUID, status Status, lastErr string, next time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rf := range m.refunds {
+		if rf.ID == id {
+			rf.Status, rf.LastError, rf.nextAttemptAt = status, lastErr, next
+			break
+		}
+	}
+	return nil
+}
+
+func inWindow(t time.Time, from, to *time.Time) bool {
+	return (from == nil || !t.Before(*from)) && (to == nil || !t.After(*to))
+}
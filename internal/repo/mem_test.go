@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const testLease = time.Minute
+
+// claimed insere um pagamento e o reivindica com owner.
+func claimed(t *testing.T, m *MemDB, owner string, amount string) BatchItem {
+	t.Helper()
+	ctx := context.Background()
+	id := uuid.New()
+	if _, err := m.EnsureUnique(ctx, id, decimal.RequireFromString(amount), ""); err != nil {
+		t.Fatalf("EnsureUnique: %v", err)
+	}
+	items, err := m.ClaimPendingBatch(ctx, owner, testLease, 1)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ClaimPendingBatch = %v, %v; want 1 item", items, err)
+	}
+	return items[0]
+}
+
+func TestMemDBLeaseGuards(t *testing.T) {
+	ctx := context.Background()
+	at := time.Now().UTC()
+	ops := map[string]func(m *MemDB, id uuid.UUID, owner string) error{
+		"Finish": func(m *MemDB, id uuid.UUID, owner string) error {
+			return m.Finish(ctx, id, owner, "default", StatusProcessed, at)
+		},
+		"Retry": func(m *MemDB, id uuid.UUID, owner string) error {
+			return m.Retry(ctx, id, owner, "default", at, at, "boom")
+		},
+		"Release": func(m *MemDB, id uuid.UUID, owner string) error {
+			return m.Release(ctx, id, owner)
+		},
+		"MarkFailed": func(m *MemDB, id uuid.UUID, owner string) error {
+			return m.MarkFailed(ctx, id, owner, "default", at, "boom")
+		},
+	}
+	for name, op := range ops {
+		t.Run(name+"/owner", func(t *testing.T) {
+			m := NewMemDB()
+			it := claimed(t, m, "a", "10")
+			if err := op(m, it.CorrelationID, "a"); err != nil {
+				t.Fatalf("%s by owner: %v", name, err)
+			}
+		})
+		t.Run(name+"/other owner", func(t *testing.T) {
+			m := NewMemDB()
+			it := claimed(t, m, "a", "10")
+			if err := op(m, it.CorrelationID, "b"); !errors.Is(err, ErrLeaseLost) {
+				t.Fatalf("%s by other owner = %v, want ErrLeaseLost", name, err)
+			}
+			pm, _ := m.GetPayment(ctx, it.CorrelationID)
+			if pm.Status != StatusDispatching {
+				t.Fatalf("status = %s, want DISPATCHING untouched", pm.Status)
+			}
+		})
+		t.Run(name+"/after finish", func(t *testing.T) {
+			m := NewMemDB()
+			it := claimed(t, m, "a", "10")
+			if err := m.Finish(ctx, it.CorrelationID, "a", "fallback", StatusProcessed, at); err != nil {
+				t.Fatalf("Finish: %v", err)
+			}
+			if err := op(m, it.CorrelationID, "a"); !errors.Is(err, ErrLeaseLost) {
+				t.Fatalf("%s after Finish = %v, want ErrLeaseLost", name, err)
+			}
+			pm, _ := m.GetPayment(ctx, it.CorrelationID)
+			if pm.Status != StatusProcessed || pm.Provider != "fallback" {
+				t.Fatalf("payment = %s/%s, want PROCESSED/fallback", pm.Status, pm.Provider)
+			}
+		})
+		t.Run(name+"/unknown", func(t *testing.T) {
+			if err := op(NewMemDB(), uuid.New(), "a"); !errors.Is(err, ErrLeaseLost) {
+				t.Fatalf("%s on unknown id = %v, want ErrLeaseLost", name, err)
+			}
+		})
+	}
+}
+
+func TestMemDBExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemDB()
+	if _, err := m.EnsureUnique(ctx, uuid.New(), decimal.NewFromInt(10), ""); err != nil {
+		t.Fatal(err)
+	}
+	items, _ := m.ClaimPendingBatch(ctx, "a", -time.Second, 1) // já nasce vencido
+	id := items[0].CorrelationID
+	if n, err := m.ReleaseExpiredLeases(ctx); err != nil || n != 1 {
+		t.Fatalf("ReleaseExpiredLeases = %d, %v; want 1", n, err)
+	}
+	if err := m.Finish(ctx, id, "a", "default", StatusProcessed, time.Now()); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Finish by expired owner = %v, want ErrLeaseLost", err)
+	}
+	again, _ := m.ClaimPendingBatch(ctx, "b", testLease, 1)
+	if len(again) != 1 || !again[0].Abandoned || again[0].Attempts != 2 {
+		t.Fatalf("reclaim = %+v, want abandoned item on attempt 2", again)
+	}
+	if err := m.Finish(ctx, id, "b", "default", StatusProcessed, time.Now()); err != nil {
+		t.Fatalf("Finish by new owner: %v", err)
+	}
+}
+
+func TestMemDBMarkFailedWithoutOwner(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name  string
+		setup func(m *MemDB) uuid.UUID
+		want  error
+	}{
+		{"pending", func(m *MemDB) uuid.UUID {
+			id := uuid.New()
+			_, _ = m.EnsureUnique(ctx, id, decimal.NewFromInt(1), "")
+			return id
+		}, nil},
+		{"dispatching", func(m *MemDB) uuid.UUID { return claimed(t, m, "a", "1").CorrelationID }, nil},
+		{"processed", func(m *MemDB) uuid.UUID {
+			it := claimed(t, m, "a", "1")
+			_ = m.Finish(ctx, it.CorrelationID, "a", "default", StatusProcessed, time.Now())
+			return it.CorrelationID
+		}, ErrNotInFlight},
+		{"unknown", func(m *MemDB) uuid.UUID { return uuid.New() }, ErrNotInFlight},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMemDB()
+			id := tc.setup(m)
+			if err := m.MarkFailed(ctx, id, "", ProviderUnassigned, time.Time{}, "x"); !errors.Is(err, tc.want) {
+				t.Fatalf("MarkFailed = %v, want %v", err, tc.want)
+			}
+			if err := m.MarkProcessed(ctx, id); !errors.Is(err, ErrNotInFlight) {
+				t.Fatalf("MarkProcessed after MarkFailed = %v, want ErrNotInFlight", err)
+			}
+		})
+	}
+}
+
+func TestMemDBReleaseKeepsAttempt(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemDB()
+	it := claimed(t, m, "a", "10")
+	sent := time.Now().UTC().Add(-time.Minute)
+	if err := m.Retry(ctx, it.CorrelationID, "a", "default", sent, time.Now(), "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	items, err := m.ClaimPendingBatch(ctx, "a", testLease, 1)
+	if err != nil || len(items) != 1 || items[0].Attempts != 2 {
+		t.Fatalf("reclaim = %+v, %v; want attempt 2", items, err)
+	}
+	if err := m.Release(ctx, it.CorrelationID, "a"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	pm, _ := m.GetPayment(ctx, it.CorrelationID)
+	if pm.Status != StatusPending || pm.Attempts != 1 || pm.LastError != "timeout" ||
+		pm.Provider != "default" || !pm.RequestedAt.Equal(sent) {
+		t.Fatalf("after Release = %+v, want PENDING, 1 attempt, last error/provider/requestedAt kept", pm)
+	}
+}
+
+func TestMemDBMarkFailedRequestedAt(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemDB()
+	it := claimed(t, m, "a", "10")
+	sent := time.Now().UTC().Add(time.Second)
+	if err := m.MarkFailed(ctx, it.CorrelationID, "a", "fallback", sent, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	pm, _ := m.GetPayment(ctx, it.CorrelationID)
+	if pm.Status != StatusFailed || pm.Provider != "fallback" || !pm.RequestedAt.Equal(sent) {
+		t.Fatalf("after MarkFailed = %+v, want FAILED on fallback at the last attempt's requestedAt", pm)
+	}
+
+	// zero mantém o requestedAt gravado
+	it = claimed(t, m, "a", "10")
+	if err := m.MarkFailed(ctx, it.CorrelationID, "a", "", time.Time{}, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	pm, _ = m.GetPayment(ctx, it.CorrelationID)
+	if !pm.RequestedAt.Equal(it.RequestedAt) {
+		t.Fatalf("requestedAt = %v, want kept %v", pm.RequestedAt, it.RequestedAt)
+	}
+}
+
+// processed cria um pagamento PROCESSED de amount no provider default.
+func processed(t *testing.T, m *MemDB, amount string) uuid.UUID {
+	t.Helper()
+	it := claimed(t, m, "a", amount)
+	if err := m.Finish(context.Background(), it.CorrelationID, "a", "default", StatusProcessed, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	return it.CorrelationID
+}
+
+func TestMemDBCreateRefund(t *testing.T) {
+	ctx := context.Background()
+	dec := func(s string) *decimal.Decimal { d := decimal.RequireFromString(s); return &d }
+
+	cases := []struct {
+		name    string
+		prior   []string // estornos já criados (valores)
+		amount  *decimal.Decimal
+		want    string
+		wantErr error
+	}{
+		{"full by default", nil, nil, "100", nil},
+		{"partial", nil, dec("30"), "30", nil},
+		{"remaining by default", []string{"30"}, nil, "70", nil},
+		{"exact remaining", []string{"30", "20"}, dec("50"), "50", nil},
+		{"exceeds remaining", []string{"80"}, dec("20.01"), "", ErrRefundExceeds},
+		{"nothing left", []string{"100"}, nil, "", ErrRefundExceeds},
+		{"zero", nil, dec("0"), "", ErrRefundExceeds},
+		{"negative", nil, dec("-1"), "", ErrRefundExceeds},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMemDB()
+			id := processed(t, m, "100")
+			for _, a := range tc.prior {
+				if _, _, err := m.CreateRefund(ctx, uuid.New(), id, dec(a)); err != nil {
+					t.Fatalf("prior refund %s: %v", a, err)
+				}
+			}
+			rf, created, err := m.CreateRefund(ctx, uuid.New(), id, tc.amount)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("CreateRefund err = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if !created || !rf.Amount.Equal(decimal.RequireFromString(tc.want)) || rf.Provider != "default" || rf.Status != StatusPending {
+				t.Fatalf("CreateRefund = %+v created=%v, want new PENDING %s on default", rf, created, tc.want)
+			}
+		})
+	}
+}
+
+func TestMemDBCreateRefundRules(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemDB()
+	paid := processed(t, m, "100")
+	other := processed(t, m, "100")
+
+	// idempotente pelo refund id
+	refundID := uuid.New()
+	first, created, err := m.CreateRefund(ctx, refundID, paid, nil)
+	if err != nil || !created {
+		t.Fatalf("first CreateRefund = %v, created=%v", err, created)
+	}
+	again, created, err := m.CreateRefund(ctx, refundID, paid, nil)
+	if err != nil || created || again.ID != first.ID || !again.Amount.Equal(first.Amount) {
+		t.Fatalf("repeat CreateRefund = %+v, created=%v, err=%v; want the existing refund", again, created, err)
+	}
+
+	// o mesmo refund id em outro pagamento
+	if _, _, err := m.CreateRefund(ctx, refundID, other, nil); !errors.Is(err, ErrRefundIDConflict) {
+		t.Fatalf("refund id of another payment = %v, want ErrRefundIDConflict", err)
+	}
+
+	// estorno FAILED libera o valor de novo
+	if err := m.FinishRefund(ctx, refundID, StatusFailed, "rejected", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if rf, _, err := m.CreateRefund(ctx, uuid.New(), paid, nil); err != nil || !rf.Amount.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("refund after FAILED = %+v, %v; want full amount again", rf, err)
+	}
+
+	// só PROCESSED é estornável
+	pending := uuid.New()
+	_, _ = m.EnsureUnique(ctx, pending, decimal.NewFromInt(10), "")
+	if _, _, err := m.CreateRefund(ctx, uuid.New(), pending, nil); !errors.Is(err, ErrNotRefundable) {
+		t.Fatalf("refund of PENDING = %v, want ErrNotRefundable", err)
+	}
+	if _, _, err := m.CreateRefund(ctx, uuid.New(), uuid.New(), nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("refund of unknown payment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemDBCreateRefundConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemDB()
+	id := processed(t, m, "100")
+	ten := decimal.NewFromInt(10)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := 0
+	for range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, created, err := m.CreateRefund(ctx, uuid.New(), id, &ten); err == nil && created {
+				mu.Lock()
+				ok++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 10 {
+		t.Fatalf("%d refunds of 10 accepted on a payment of 100, want exactly 10", ok)
+	}
+}
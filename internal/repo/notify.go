@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Canal do NOTIFY disparado pelo trigger de INSERT em payments (ver sql/ddl.sql).
+const notifyChannel = "payments_new"
+
+const listenRetryEvery = time.Second
+
+// Notifications mantém uma conexão dedicada em LISTEN e sinaliza no canal
+// devolvido a cada NOTIFY. Sinais são coalescidos: se ninguém consumiu o
+// anterior, o novo é descartado. Reconecta sozinho até ctx ser cancelado.
+func (p *PgxDB) Notifications(ctx context.Context) <-chan struct{} {
+	out := make(chan struct{}, 1)
+	go func() {
+		for ctx.Err() == nil {
+			if err := p.listen(ctx, out); err != nil && ctx.Err() == nil {
+				log.Printf("listen %s err: %v", notifyChannel, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(listenRetryEvery):
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func (p *PgxDB) listen(ctx context.Context, out chan<- struct{}) error {
+	pc, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// a conexão fica presa em LISTEN: sai do pool de vez (Hijack) e é fechada
+	// aqui, para nunca voltar ao pool ainda inscrita no canal
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	// acorda uma vez ao (re)conectar: pode ter chegado algo enquanto estava fora
+	signal(out)
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		signal(out)
+	}
+}
+
+func signal(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
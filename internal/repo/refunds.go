@@ -0,0 +1,174 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrNotRefundable    = errors.New("payment is not PROCESSED")
+	ErrRefundExceeds    = errors.New("refund exceeds remaining amount")
+	ErrRefundIDConflict = errors.New("refund id belongs to another payment")
+)
+
+// Estorno de um pagamento, sempre no provider que processou o original
+type Refund struct {
+	ID            uuid.UUID       `json:"refundId"`
+	CorrelationID uuid.UUID       `json:"correlationId"`
+	Provider      Provider        `json:"provider"`
+	Amount        decimal.Decimal `json:"amount"`
+	Status        Status          `json:"status"` // PENDING -> PROCESSED/FAILED
+	RequestedAt   time.Time       `json:"requestedAt"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError,omitempty"`
+}
+
+// CreateRefund registra o estorno (idempotente por refund id). amount nil = valor
+// restante do pagamento. created=false devolve o estorno já existente; refund id de
+// outro pagamento dá ErrRefundIDConflict.
+func (p *PgxDB) CreateRefund(ctx context.Context, refundID, correlationID uuid.UUID, amount *decimal.Decimal) (Refund, bool, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return Refund{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	existing := func() (Refund, bool, error) {
+		rf, err := scanRefund(tx.QueryRow(ctx, refundSelect+` WHERE id=$1`, refundID))
+		if err != nil {
+			return Refund{}, false, err
+		}
+		if rf.CorrelationID != correlationID {
+			return Refund{}, true, ErrRefundIDConflict
+		}
+		return rf, true, nil
+	}
+	if rf, found, err := existing(); found || (err != nil && !errors.Is(err, pgx.ErrNoRows)) {
+		return rf, false, err
+	}
+
+	// trava o pagamento para serializar estornos concorrentes do mesmo correlation_id.
+	// A soma vem num statement separado: em READ COMMITTED, o snapshot dele já enxerga
+	// os estornos commitados por quem segurava o lock antes.
+	var status Status
+	var provider Provider
+	var paidStr string
+	err = tx.QueryRow(ctx, `
+		SELECT status, provider, amount
+		  FROM payments
+		 WHERE correlation_id=$1
+		   FOR UPDATE
+	`, correlationID).Scan(&status, &provider, &paidStr)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Refund{}, false, ErrNotFound
+	}
+	if err != nil {
+		return Refund{}, false, err
+	}
+	// o mesmo refund id pode ter sido gravado enquanto esperávamos o lock
+	if rf, found, err := existing(); found || (err != nil && !errors.Is(err, pgx.ErrNoRows)) {
+		return rf, false, err
+	}
+	if status != StatusProcessed {
+		return Refund{}, false, ErrNotRefundable
+	}
+	var refundedStr string
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(sum(amount), 0)
+		  FROM refunds
+		 WHERE correlation_id=$1 AND status <> 'FAILED'
+	`, correlationID).Scan(&refundedStr)
+	if err != nil {
+		return Refund{}, false, err
+	}
+	paid, _ := decimal.NewFromString(paidStr)
+	refunded, _ := decimal.NewFromString(refundedStr)
+	remaining := paid.Sub(refunded)
+	amt := remaining
+	if amount != nil {
+		amt = *amount
+	}
+	if !amt.IsPositive() || amt.GreaterThan(remaining) {
+		return Refund{}, false, ErrRefundExceeds
+	}
+
+	// corrida com o mesmo refund id em outro pagamento (lock diferente): não vira 500
+	rf, err := scanRefund(tx.QueryRow(ctx, `
+		INSERT INTO refunds (id, correlation_id, provider, amount)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, correlation_id, provider, amount, status, requested_at, attempts, COALESCE(last_error, '')
+	`, refundID, correlationID, provider, amt))
+	if errors.Is(err, pgx.ErrNoRows) {
+		rf, _, err = existing()
+		return rf, false, err
+	}
+	if err != nil {
+		return Refund{}, false, err
+	}
+	return rf, true, tx.Commit(ctx)
+}
+
+// ClaimRefunds: pega estornos PENDING vencidos e os esconde por visibility.
+func (p *PgxDB) ClaimRefunds(ctx context.Context, visibility time.Duration, limit int) ([]Refund, error) {
+	rows, err := p.pool.Query(ctx, `
+		WITH cte AS (
+		  SELECT id
+		    FROM refunds
+		   WHERE status = 'PENDING'
+		     AND next_attempt_at <= now()
+		   ORDER BY next_attempt_at
+		   FOR UPDATE SKIP LOCKED
+		   LIMIT $1
+		)
+		UPDATE refunds r
+		   SET attempts = r.attempts + 1
+		     , next_attempt_at = now() + $2::float8 * interval '1 millisecond'
+		  FROM cte
+		 WHERE r.id = cte.id
+		RETURNING r.id, r.correlation_id, r.provider, r.amount, r.status, r.requested_at, r.attempts, COALESCE(r.last_error, '')
+	`, limit, visibility.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Refund
+	for rows.Next() {
+		rf, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rf)
+	}
+	return out, rows.Err()
+}
+
+// FinishRefund grava o resultado de uma tentativa; next só vale para PENDING.
+func (p *PgxDB) FinishRefund(ctx context.Context, id uuid.UUID, status Status, lastErr string, next time.Time) error {
+	_, err := p.pool.Exec(ctx, `
+		UPDATE refunds
+		   SET status=$2, last_error=NULLIF($3, ''), next_attempt_at=$4
+		 WHERE id=$1
+	`, id, status, lastErr, next)
+	return err
+}
+
+const refundSelect = `
+	SELECT id, correlation_id, provider, amount, status, requested_at, attempts, COALESCE(last_error, '')
+	  FROM refunds`
+
+func scanRefund(row pgx.Row) (Refund, error) {
+	var rf Refund
+	var amtStr string
+	if err := row.Scan(&rf.ID, &rf.CorrelationID, &rf.Provider, &amtStr, &rf.Status, &rf.RequestedAt, &rf.Attempts, &rf.LastError); err != nil {
+		return Refund{}, err
+	}
+	rf.Amount, _ = decimal.NewFromString(amtStr)
+	return rf, nil
+}
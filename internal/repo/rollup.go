@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Granularidade de payment_rollups (mantida pelo trigger payments_rollup)
+const rollupBucket = time.Minute
+
+// sqlArgs: monta placeholders $N conforme os filtros vão entrando na query.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// rollupSplit divide [from, to] em buckets inteiros [lo, hi), servidos pelos rollups,
+// e as bordas parciais, que continuam no scan bruto. ok=false: não sobra bucket inteiro.
+func rollupSplit(from, to *time.Time) (lo, hi *time.Time, ok bool) {
+	if from != nil {
+		t := from.Truncate(rollupBucket)
+		if t.Before(*from) {
+			t = t.Add(rollupBucket)
+		}
+		lo = &t
+	}
+	if to != nil {
+		t := to.Truncate(rollupBucket)
+		hi = &t
+	}
+	if lo != nil && hi != nil && !lo.Before(*hi) {
+		return nil, nil, false
+	}
+	return lo, hi, true
+}
+
+// processedSource: subquery (provider, c, a) com os PROCESSED da janela = rollups dos
+// buckets inteiros + scan bruto das bordas. provider nil = todos.
+func processedSource(args *sqlArgs, provider *Provider, from, to *time.Time) string {
+	var rollup, raw []string
+	if provider != nil {
+		ph := args.add(*provider)
+		rollup = append(rollup, "provider = "+ph)
+		raw = append(raw, "provider = "+ph)
+	}
+
+	lo, hi, ok := rollupSplit(from, to)
+	switch {
+	case !ok:
+		rollup = append(rollup, "false")
+		if from != nil {
+			raw = append(raw, "requested_at >= "+args.add(*from))
+		}
+		if to != nil {
+			raw = append(raw, "requested_at <= "+args.add(*to))
+		}
+	default:
+		var edges []string
+		if lo != nil {
+			phLo := args.add(*lo)
+			rollup = append(rollup, "bucket >= "+phLo)
+			edges = append(edges, "(requested_at >= "+args.add(*from)+" AND requested_at < "+phLo+")")
+		}
+		if hi != nil {
+			phHi := args.add(*hi)
+			rollup = append(rollup, "bucket < "+phHi)
+			edges = append(edges, "(requested_at >= "+phHi+" AND requested_at <= "+args.add(*to)+")")
+		}
+		if len(edges) == 0 {
+			edges = append(edges, "false")
+		}
+		raw = append(raw, "("+strings.Join(edges, " OR ")+")")
+	}
+
+	if len(rollup) == 0 {
+		rollup = append(rollup, "true")
+	}
+	return `
+		SELECT provider, total_requests AS c, total_amount AS a
+		  FROM payment_rollups
+		 WHERE ` + strings.Join(rollup, " AND ") + `
+		UNION ALL
+		SELECT provider, count(*), sum(amount)
+		  FROM payments
+		 WHERE status = 'PROCESSED' AND ` + strings.Join(raw, " AND ") + `
+		 GROUP BY provider`
+}
@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollupSplit(t *testing.T) {
+	at := func(s string) *time.Time {
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &v
+	}
+	cases := []struct {
+		name     string
+		from, to *time.Time
+		lo, hi   *time.Time
+		ok       bool
+	}{
+		{"open window", nil, nil, nil, nil, true},
+		{"only from, aligned", at("2025-07-01T10:00:00Z"), nil, at("2025-07-01T10:00:00Z"), nil, true},
+		{"only from, mid-minute rounds up", at("2025-07-01T10:00:00.001Z"), nil, at("2025-07-01T10:01:00Z"), nil, true},
+		{"only to, mid-minute rounds down", nil, at("2025-07-01T10:05:59.999Z"), nil, at("2025-07-01T10:05:00Z"), true},
+		{"only to, aligned", nil, at("2025-07-01T10:05:00Z"), nil, at("2025-07-01T10:05:00Z"), true},
+		{"aligned both ends", at("2025-07-01T10:00:00Z"), at("2025-07-01T10:05:00Z"),
+			at("2025-07-01T10:00:00Z"), at("2025-07-01T10:05:00Z"), true},
+		{"partial both ends", at("2025-07-01T10:00:30Z"), at("2025-07-01T10:05:30Z"),
+			at("2025-07-01T10:01:00Z"), at("2025-07-01T10:05:00Z"), true},
+		{"exactly one whole bucket", at("2025-07-01T10:00:00Z"), at("2025-07-01T10:01:00Z"),
+			at("2025-07-01T10:00:00Z"), at("2025-07-01T10:01:00Z"), true},
+		{"inside one minute", at("2025-07-01T10:00:10Z"), at("2025-07-01T10:00:50Z"), nil, nil, false},
+		{"straddles one boundary only", at("2025-07-01T10:00:30Z"), at("2025-07-01T10:01:30Z"), nil, nil, false},
+		{"from after to", at("2025-07-01T10:05:00Z"), at("2025-07-01T10:00:00Z"), nil, nil, false},
+		{"from equals to", at("2025-07-01T10:05:00Z"), at("2025-07-01T10:05:00Z"), nil, nil, false},
+	}
+	eq := func(a, b *time.Time) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Equal(*b)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lo, hi, ok := rollupSplit(tc.from, tc.to)
+			if ok != tc.ok || !eq(lo, tc.lo) || !eq(hi, tc.hi) {
+				t.Fatalf("rollupSplit = %v, %v, %v; want %v, %v, %v", lo, hi, ok, tc.lo, tc.hi, tc.ok)
+			}
+			// os buckets inteiros ficam dentro da janela pedida
+			if lo != nil && tc.from != nil && lo.Before(*tc.from) {
+				t.Fatalf("lo %v before from %v", lo, tc.from)
+			}
+			if hi != nil && tc.to != nil && hi.After(*tc.to) {
+				t.Fatalf("hi %v after to %v", hi, tc.to)
+			}
+		})
+	}
+}
+
+func TestProcessedSourceEdges(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2025-07-01T10:00:30Z")
+	to, _ := time.Parse(time.RFC3339, "2025-07-01T10:05:30Z")
+	p := Provider("default")
+
+	cases := []struct {
+		name      string
+		provider  *Provider
+		from, to  *time.Time
+		wantArgs  int
+		wantParts []string
+	}{
+		{"whole history from rollups", nil, nil, nil, 0, []string{"WHERE true", "WHERE status = 'PROCESSED' AND (false)"}},
+		{"both edges", &p, &from, &to, 5, []string{"provider = $1", "bucket >= $2", "bucket < $4", "requested_at < $2", "requested_at >= $4"}},
+		{"no whole bucket scans raw only", nil, &from, ptr(from.Add(20 * time.Second)), 2, []string{"WHERE false", "requested_at >= $1", "requested_at <= $2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var args sqlArgs
+			q := processedSource(&args, tc.provider, tc.from, tc.to)
+			if len(args) != tc.wantArgs {
+				t.Fatalf("args = %v, want %d", args, tc.wantArgs)
+			}
+			for _, part := range tc.wantParts {
+				if !strings.Contains(q, part) {
+					t.Fatalf("query missing %q:\n%s", part, q)
+				}
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestSummaryProcessedQueryScansOnlyEdges(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2025-07-01T10:00:30Z")
+	to, _ := time.Parse(time.RFC3339, "2025-07-01T10:05:30Z")
+	cases := []struct {
+		name     string
+		from, to *time.Time
+		rawScan  []string // filtros obrigatórios no scan bruto de payments
+	}{
+		{"open window", nil, nil, []string{"(false)"}},
+		{"both edges", &from, &to, []string{"requested_at >= $2 AND requested_at < $1", "requested_at >= $3 AND requested_at <= $4"}},
+		{"only from", &from, nil, []string{"requested_at >= $2 AND requested_at < $1"}},
+		{"only to", nil, &to, []string{"requested_at >= $1 AND requested_at <= $2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, args := summaryProcessedQuery(tc.from, tc.to)
+			// todo timestamp ligado à query (bordas e minutos cheios) fica dentro da janela pedida
+			for _, a := range args {
+				if ts, ok := a.(time.Time); ok && ((tc.from != nil && ts.Before(*tc.from)) || (tc.to != nil && ts.After(*tc.to))) {
+					t.Fatalf("bound %v outside the window [%v, %v]", ts, tc.from, tc.to)
+				}
+			}
+			if n := strings.Count(q, "FROM payments"); n != 1 {
+				t.Fatalf("%d scans of payments, want only the edge scan:\n%s", n, q)
+			}
+			raw := q[strings.Index(q, "FROM payments"):]
+			raw = raw[:strings.Index(raw, "GROUP BY")]
+			if !strings.Contains(raw, "status = 'PROCESSED'") {
+				t.Fatalf("raw scan not restricted to PROCESSED:\n%s", raw)
+			}
+			for _, f := range tc.rawScan {
+				if !strings.Contains(raw, f) {
+					t.Fatalf("raw scan missing edge filter %q:\n%s", f, raw)
+				}
+			}
+			for _, s := range []string{"PENDING", "DISPATCHING", "FAILED"} {
+				if strings.Contains(q, s) {
+					t.Fatalf("query touches %s rows:\n%s", s, q)
+				}
+			}
+			if !strings.Contains(q, "FROM refunds\n\t\t WHERE status = 'PROCESSED'") {
+				t.Fatalf("refunds not restricted to PROCESSED:\n%s", q)
+			}
+		})
+	}
+}
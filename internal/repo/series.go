@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Granularidade da série temporal do summary (mesmos nomes aceitos pelo date_trunc)
+type Bucket string
+
+const (
+	BucketMinute Bucket = "minute"
+	BucketHour   Bucket = "hour"
+	BucketDay    Bucket = "day"
+)
+
+func ParseBucket(s string) (Bucket, error) {
+	switch b := Bucket(s); b {
+	case BucketMinute, BucketHour, BucketDay:
+		return b, nil
+	default:
+		return "", fmt.Errorf("invalid bucket: %q", s)
+	}
+}
+
+// Truncate alinha t ao início do bucket (em UTC)
+func (b Bucket) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch b {
+	case BucketMinute:
+		return t.Truncate(time.Minute)
+	case BucketHour:
+		return t.Truncate(time.Hour)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Ponto da série: PROCESSED de um provider dentro de um bucket
+type SeriesPoint struct {
+	Provider Provider
+	Bucket   time.Time
+	Count    int64
+	Amount   decimal.Decimal
+}
+
+// SummarySeries agrega PROCESSED por provider e bucket (date_trunc em UTC), em ordem
+// de provider e bucket. Buckets sem pagamentos não aparecem.
+func (p *PgxDB) SummarySeries(ctx context.Context, bucket Bucket, from, to *time.Time) ([]SeriesPoint, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT provider, date_trunc($1, requested_at, 'UTC') AS b, count(*), sum(amount)::text
+		  FROM payments
+		 WHERE status='PROCESSED'
+		   AND ($2::timestamptz IS NULL OR requested_at >= $2)
+		   AND ($3::timestamptz IS NULL OR requested_at <= $3)
+		 GROUP BY provider, b
+		 ORDER BY provider, b
+	`, string(bucket), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SeriesPoint
+	for rows.Next() {
+		var sp SeriesPoint
+		var amt string
+		if err := rows.Scan(&sp.Provider, &sp.Bucket, &sp.Count, &amt); err != nil {
+			return nil, err
+		}
+		sp.Bucket = sp.Bucket.UTC()
+		sp.Amount, _ = decimal.NewFromString(amt)
+		out = append(out, sp)
+	}
+	return out, rows.Err()
+}
+
+func (m *MemDB) SummarySeries(ctx context.Context, bucket Bucket, from, to *time.Time) ([]SeriesPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type key struct {
+		provider Provider
+		bucket   time.Time
+	}
+	agg := map[key]*SeriesPoint{}
+	for _, r := range m.rows {
+		if r.status != StatusProcessed || !inWindow(r.requestedAt, from, to) {
+			continue
+		}
+		k := key{r.provider, bucket.Truncate(r.requestedAt)}
+		sp := agg[k]
+		if sp == nil {
+			sp = &SeriesPoint{Provider: k.provider, Bucket: k.bucket, Amount: decimal.Zero}
+			agg[k] = sp
+		}
+		sp.Count++
+		sp.Amount = sp.Amount.Add(r.amount)
+	}
+
+	out := make([]SeriesPoint, 0, len(agg))
+	for _, sp := range agg {
+		out = append(out, *sp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		return out[i].Bucket.Before(out[j].Bucket)
+	})
+	return out, nil
+}
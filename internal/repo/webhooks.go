@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "PENDING"
+	WebhookDelivered WebhookStatus = "DELIVERED"
+	WebhookFailed    WebhookStatus = "FAILED"
+)
+
+// Webhook reivindicado para entrega, já com os dados do pagamento.
+type Webhook struct {
+	ID            int64
+	CorrelationID uuid.UUID
+	URL           string
+	Event         Status // status do pagamento que gerou o callback
+	Amount        decimal.Decimal
+	Provider      Provider
+	RequestedAt   time.Time
+	LastError     string // último erro do pagamento (FAILED)
+	Attempts      int    // já contando a tentativa atual
+}
+
+// Linha do log de entregas (webhook_deliveries)
+type WebhookDelivery struct {
+	ID            int64         `json:"id"`
+	CorrelationID uuid.UUID     `json:"correlationId"`
+	URL           string        `json:"url"`
+	Event         Status        `json:"event"`
+	Status        WebhookStatus `json:"status"`
+	Attempts      int           `json:"attempts"`
+	LastCode      int           `json:"lastCode"`
+	LastError     string        `json:"lastError"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	DeliveredAt   *time.Time    `json:"deliveredAt"`
+}
+
+// ClaimWebhooks: pega entregas PENDING vencidas e as esconde por visibility
+// (se a instância cair, voltam a ficar visíveis sozinhas).
+func (p *PgxDB) ClaimWebhooks(ctx context.Context, visibility time.Duration, limit int) ([]Webhook, error) {
+	rows, err := p.pool.Query(ctx, `
+		WITH cte AS (
+		  SELECT id
+		    FROM webhook_deliveries
+		   WHERE status = 'PENDING'
+		     AND next_attempt_at <= now()
+		   ORDER BY next_attempt_at
+		   FOR UPDATE SKIP LOCKED
+		   LIMIT $1
+		)
+		UPDATE webhook_deliveries w
+		   SET attempts = w.attempts + 1
+		     , next_attempt_at = now() + $2::float8 * interval '1 millisecond'
+		  FROM cte, payments p
+		 WHERE w.id = cte.id
+		   AND p.correlation_id = w.correlation_id
+		RETURNING w.id, w.correlation_id, w.url, w.event, p.amount, p.provider, p.requested_at
+		        , COALESCE(p.last_error, ''), w.attempts
+	`, limit, visibility.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Webhook
+	for rows.Next() {
+		var wh Webhook
+		var amtStr string
+		if err := rows.Scan(&wh.ID, &wh.CorrelationID, &wh.URL, &wh.Event, &amtStr, &wh.Provider, &wh.RequestedAt, &wh.LastError, &wh.Attempts); err != nil {
+			return nil, err
+		}
+		wh.Amount, _ = decimal.NewFromString(amtStr)
+		out = append(out, wh)
+	}
+	return out, rows.Err()
+}
+
+// RecordWebhookAttempt grava o resultado de uma tentativa; next só vale para PENDING.
+func (p *PgxDB) RecordWebhookAttempt(ctx context.Context, id int64, status WebhookStatus, code int, lastErr string, next time.Time) error {
+	_, err := p.pool.Exec(ctx, `
+		UPDATE webhook_deliveries
+		   SET status=$2, last_code=$3, last_error=NULLIF($4, ''), next_attempt_at=$5
+		     , delivered_at = CASE WHEN $2 = 'DELIVERED' THEN now() END
+		 WHERE id=$1
+	`, id, status, code, lastErr, next)
+	return err
+}
+
+func (p *PgxDB) ListWebhookDeliveries(ctx context.Context, correlationID uuid.UUID) ([]WebhookDelivery, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT id, correlation_id, url, event, status, attempts, last_code, COALESCE(last_error, ''), created_at, delivered_at
+		  FROM webhook_deliveries
+		 WHERE correlation_id=$1
+		 ORDER BY id
+	`, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.CorrelationID, &d.URL, &d.Event, &d.Status, &d.Attempts, &d.LastCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
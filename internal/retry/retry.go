@@ -0,0 +1,36 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy: backoff exponencial com jitter entre tentativas (pagamentos, webhooks).
+type Policy struct {
+	MaxAttempts int           // total de tentativas antes de desistir (0 = sem limite)
+	BaseBackoff time.Duration // espera após a 1ª falha
+	MaxBackoff  time.Duration // teto da espera (<= 0 = sem teto)
+}
+
+// Exhausted informa se, depois de attempts tentativas, não há mais retry.
+func (p Policy) Exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// Backoff devolve a espera após a tentativa de número attempts (1 = primeira),
+// base·2^(attempts-1) limitado a MaxBackoff (<= 0 = sem teto), com ±20% de jitter.
+func (p Policy) Backoff(attempts int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < attempts && d > 0 && d <= math.MaxInt64/4; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(d) * jitter)
+}
@@ -0,0 +1,58 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		name     string
+		p        Policy
+		attempts int
+		want     time.Duration // antes do jitter
+	}{
+		{"first attempt is base", Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 1, 100 * time.Millisecond},
+		{"doubles per attempt", Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 3, 400 * time.Millisecond},
+		{"clamped to max", Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 5, time.Second},
+		{"clamped after overshoot", Policy{BaseBackoff: 300 * time.Millisecond, MaxBackoff: time.Second}, 3, time.Second},
+		{"zero max means no cap", Policy{BaseBackoff: 100 * time.Millisecond}, 5, 1600 * time.Millisecond},
+		{"negative max means no cap", Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: -1}, 4, 800 * time.Millisecond},
+		{"attempts zero is base", Policy{BaseBackoff: 100 * time.Millisecond}, 0, 100 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for range 20 {
+				got := tc.p.Backoff(tc.attempts)
+				lo, hi := time.Duration(float64(tc.want)*0.8), time.Duration(float64(tc.want)*1.2)
+				if got < lo || got > hi {
+					t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tc.attempts, got, lo, hi)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffNoCapDoesNotOverflow(t *testing.T) {
+	p := Policy{BaseBackoff: time.Second}
+	if got := p.Backoff(200); got <= 0 {
+		t.Fatalf("Backoff(200) = %v, want positive", got)
+	}
+}
+
+func TestExhausted(t *testing.T) {
+	cases := []struct {
+		max, attempts int
+		want          bool
+	}{
+		{0, 100, false},
+		{3, 2, false},
+		{3, 3, true},
+		{3, 4, true},
+	}
+	for _, tc := range cases {
+		if got := (Policy{MaxAttempts: tc.max}).Exhausted(tc.attempts); got != tc.want {
+			t.Errorf("Exhausted(max=%d, attempts=%d) = %v, want %v", tc.max, tc.attempts, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package tracing configura o OpenTelemetry e ajuda a costurar o trace de um
+// pagamento entre o intake, a linha no banco e o despacho.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const name = "github.com/josinaldojr/rinha-backend-2025"
+
+var propagator = propagation.TraceContext{}
+
+// Setup instala o TracerProvider global. exporter: "" ou "none" (desligado), "stdout"
+// ou "otlp" (OTLP/HTTP; endpoint pelas variáveis OTEL_EXPORTER_OTLP_*).
+// O shutdown devolvido descarrega os spans pendentes.
+func Setup(ctx context.Context, exporter, instanceID string, ratio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "rinha-api"
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.ServiceInstanceID(instanceID),
+	)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start abre um span interno do serviço.
+func Start(ctx context.Context, span string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(name).Start(ctx, span, trace.WithAttributes(attrs...))
+}
+
+// StartClient abre um span de chamada HTTP de saída e propaga o contexto nos headers de req.
+func StartClient(req *http.Request, span string, attrs ...attribute.KeyValue) (*http.Request, trace.Span) {
+	ctx, sp := otel.Tracer(name).Start(req.Context(), span,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs,
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+		)...),
+	)
+	req = req.WithContext(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, sp
+}
+
+// End fecha o span marcando erro quando houver.
+func End(sp trace.Span, err error) {
+	if err != nil {
+		sp.RecordError(err)
+		sp.SetStatus(codes.Error, err.Error())
+	}
+	sp.End()
+}
+
+// TraceParent serializa o span corrente (W3C traceparent) para gravar na linha;
+// "" quando não há span válido. Span não amostrado também sai (flags -00): com o
+// sampler ParentBased, despacho e reconciler seguem a decisão do intake em vez
+// de abrir traces órfãos.
+func TraceParent(ctx context.Context) string {
+	c := propagation.MapCarrier{}
+	propagator.Inject(ctx, c)
+	return c["traceparent"]
+}
+
+// FromTraceParent devolve ctx com o span gravado na linha como pai remoto.
+func FromTraceParent(ctx context.Context, tp string) context.Context {
+	if tp == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": tp})
+}
+
+// HTTP abre o span de servidor de cada requisição, continuando o trace do cliente.
+func HTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, sp := otel.Tracer(name).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)),
+		)
+		defer sp.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rc := chi.RouteContext(ctx); rc != nil && rc.RoutePattern() != "" {
+			sp.SetName(r.Method + " " + rc.RoutePattern())
+			sp.SetAttributes(semconv.HTTPRoute(rc.RoutePattern()))
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		sp.SetAttributes(semconv.HTTPResponseStatusCode(code))
+		if code >= 500 {
+			sp.SetStatus(codes.Error, http.StatusText(code))
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParent(t *testing.T) {
+	if tp := TraceParent(context.Background()); tp != "" {
+		t.Fatalf("no span: %q, want empty", tp)
+	}
+
+	tid, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	sid, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	for _, flags := range []trace.TraceFlags{trace.FlagsSampled, 0} {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: flags})
+		tp := TraceParent(trace.ContextWithSpanContext(context.Background(), sc))
+		if !strings.HasPrefix(tp, "00-"+tid.String()+"-"+sid.String()+"-") {
+			t.Fatalf("flags %s: traceparent = %q", flags, tp)
+		}
+		// a decisão de amostragem atravessa a linha gravada
+		got := trace.SpanContextFromContext(FromTraceParent(context.Background(), tp))
+		if !got.IsRemote() || got.TraceID() != tid || got.IsSampled() != flags.IsSampled() {
+			t.Fatalf("flags %s: round trip = %+v", flags, got)
+		}
+	}
+}
@@ -4,11 +4,31 @@ create table if not exists payments (
   id uuid primary key default gen_random_uuid(),
   correlation_id uuid not null unique,
   amount numeric(18,2) not null,
-  provider text not null check (provider in ('default','fallback')),
+  provider text not null default '', -- '' = ainda não despachado; nomes vêm do registry (PROVIDERS)
   status text not null check (status in ('PENDING','DISPATCHING','PROCESSED','FAILED')), -- add DISPATCHING
-  requested_at timestamptz not null default now()
+  requested_at timestamptz not null default now(),
+  attempts int not null default 0,
+  next_attempt_at timestamptz not null default now(), -- retry com backoff: só reivindicável a partir daqui
+  last_error text,
+  lease_owner text,        -- instância que reivindicou (DISPATCHING); sobra após lease vencido = abandonado
+  lease_until timestamptz, -- visibilidade: vencido volta para PENDING
+  callback_url text,       -- webhook opcional em PROCESSED/FAILED
+  trace_parent text        -- W3C traceparent do intake: despacho e reconciler continuam o trace
 );
 
+-- bases criadas pelo schema antigo: provider era check ('default','fallback') sem default
+alter table payments drop constraint if exists payments_provider_check;
+alter table payments alter column provider set default '';
+
+-- colunas novas em bases anteriores ao create acima (retry, lease, webhook, trace)
+alter table payments add column if not exists attempts int not null default 0;
+alter table payments add column if not exists next_attempt_at timestamptz not null default now();
+alter table payments add column if not exists last_error text;
+alter table payments add column if not exists lease_owner text;
+alter table payments add column if not exists lease_until timestamptz;
+alter table payments add column if not exists callback_url text;
+alter table payments add column if not exists trace_parent text;
+
 create index if not exists idx_payments_provider_requested_at
   on payments(provider, requested_at);
 
@@ -16,8 +36,161 @@ create index if not exists idx_payments_provider_requested_at
 create index if not exists idx_payments_status_requested_at
   on payments(status, requested_at);
 
+-- varredura de leases vencidos
+create index if not exists idx_payments_dispatching_lease
+  on payments(lease_until)
+  where status = 'DISPATCHING';
+
+-- claim do dispatcher: PENDING com next_attempt_at vencido
+create index if not exists idx_payments_pending_next_attempt
+  on payments(next_attempt_at)
+  where status = 'PENDING';
+
+-- acorda o dispatcher (LISTEN payments_new) a cada pagamento realmente inserido;
+-- trigger por linha não dispara para ON CONFLICT DO NOTHING
+create or replace function payments_notify() returns trigger as $$
+begin
+  perform pg_notify('payments_new', '');
+  return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists payments_notify on payments;
+create trigger payments_notify
+  after insert on payments
+  for each row execute function payments_notify();
+
 -- rode uma vez (após dropar/recriar a tabela, crie de novo)
 create index if not exists idx_payments_summary_proc
   on payments (provider, requested_at)
   where status = 'PROCESSED';
 
+
+-- estado compartilhado do decider entre instâncias (health + breaker)
+create table if not exists provider_state (
+  provider text primary key,
+  failing boolean not null default false,
+  min_response_ms int not null default 0,
+  health_at timestamptz,
+  breaker text not null default 'closed',
+  breaker_until timestamptz,
+  breaker_by text not null default ''
+);
+
+-- dead-letter: pagamentos que esgotaram as tentativas (requeue via /admin ou cmd/admin)
+create or replace view payments_dead_letter as
+  select correlation_id, amount, provider, requested_at, attempts, coalesce(last_error, '') as last_error
+    from payments
+   where status = 'FAILED';
+
+-- webhooks: callback_url opcional por pagamento; o trigger enfileira uma entrega
+-- sempre que o status muda para PROCESSED/FAILED (dispatcher ou reconciler)
+create table if not exists webhook_deliveries (
+  id bigserial primary key,
+  correlation_id uuid not null references payments(correlation_id),
+  url text not null,
+  event text not null,                       -- status do pagamento que gerou o callback
+  status text not null default 'PENDING' check (status in ('PENDING','DELIVERED','FAILED')),
+  attempts int not null default 0,
+  next_attempt_at timestamptz not null default now(),
+  last_code int not null default 0,
+  last_error text,
+  created_at timestamptz not null default now(),
+  delivered_at timestamptz
+);
+
+create index if not exists idx_webhook_deliveries_pending
+  on webhook_deliveries(next_attempt_at)
+  where status = 'PENDING';
+
+create index if not exists idx_webhook_deliveries_correlation
+  on webhook_deliveries(correlation_id);
+
+create or replace function payments_enqueue_webhook() returns trigger as $$
+begin
+  insert into webhook_deliveries (correlation_id, url, event)
+  values (new.correlation_id, new.callback_url, new.status);
+  return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists payments_enqueue_webhook on payments;
+create trigger payments_enqueue_webhook
+  after update of status on payments
+  for each row
+  when (new.callback_url is not null
+        and new.status in ('PROCESSED','FAILED')
+        and old.status is distinct from new.status)
+  execute function payments_enqueue_webhook();
+
+-- estornos: sempre no provider que processou o pagamento original
+create table if not exists refunds (
+  id uuid primary key,                       -- refundId (idempotência)
+  correlation_id uuid not null references payments(correlation_id),
+  provider text not null,
+  amount numeric(18,2) not null check (amount > 0),
+  status text not null default 'PENDING' check (status in ('PENDING','PROCESSED','FAILED')),
+  requested_at timestamptz not null default now(),
+  attempts int not null default 0,
+  next_attempt_at timestamptz not null default now(),
+  last_error text
+);
+
+create index if not exists idx_refunds_correlation
+  on refunds(correlation_id);
+
+create index if not exists idx_refunds_pending
+  on refunds(next_attempt_at)
+  where status = 'PENDING';
+
+create index if not exists idx_refunds_summary_proc
+  on refunds (provider, requested_at)
+  where status = 'PROCESSED';
+
+-- rollups do summary: PROCESSED por provider e minuto, mantidos pelo trigger no mesmo
+-- statement do Finish/MarkProcessed. O summary soma buckets inteiros daqui e só
+-- varre payments nas bordas da janela from/to.
+create table if not exists payment_rollups (
+  provider text not null,
+  bucket timestamptz not null,               -- date_trunc('minute', requested_at)
+  total_requests bigint not null default 0,
+  total_amount numeric not null default 0,
+  primary key (provider, bucket)
+);
+
+create or replace function payments_rollup() returns trigger as $$
+begin
+  if old.status = 'PROCESSED' then
+    insert into payment_rollups as r (provider, bucket, total_requests, total_amount)
+    values (old.provider, date_trunc('minute', old.requested_at, 'UTC'), -1, -old.amount)
+    on conflict (provider, bucket) do update
+      set total_requests = r.total_requests + excluded.total_requests,
+          total_amount = r.total_amount + excluded.total_amount;
+  end if;
+  if new.status = 'PROCESSED' then
+    insert into payment_rollups as r (provider, bucket, total_requests, total_amount)
+    values (new.provider, date_trunc('minute', new.requested_at, 'UTC'), 1, new.amount)
+    on conflict (provider, bucket) do update
+      set total_requests = r.total_requests + excluded.total_requests,
+          total_amount = r.total_amount + excluded.total_amount;
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists payments_rollup on payments;
+create trigger payments_rollup
+  after update of status, provider, requested_at on payments
+  for each row
+  when ((old.status = 'PROCESSED' or new.status = 'PROCESSED')
+        and (old.status, old.provider, old.requested_at)
+            is distinct from (new.status, new.provider, new.requested_at))
+  execute function payments_rollup();
+
+-- backfill de bases que já tinham PROCESSED antes dos rollups (só se a tabela está vazia)
+insert into payment_rollups (provider, bucket, total_requests, total_amount)
+select provider, date_trunc('minute', requested_at, 'UTC'), count(*), sum(amount)
+  from payments
+ where status = 'PROCESSED'
+   and not exists (select 1 from payment_rollups)
+ group by 1, 2;